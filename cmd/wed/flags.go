@@ -36,9 +36,10 @@ var settings FlagSettings
 // NewSettingsFromJSON creates a new Settings instance from a JSON string.
 func NewSettingsFromJSON(spath string) (s FileSettings, err error) {
 	s = FileSettings{spath, engine.Settings{
-		OutputDir: "build",
-		InputDir:  ".",
-		Module:    "text/javascript",
+		OutputDir:  "build",
+		InputDir:   ".",
+		Module:     "text/javascript",
+		ProjectDir: filepath.Dir(spath),
 	}}
 
 	b, err := os.ReadFile(spath)
@@ -86,6 +87,7 @@ func serveFlags() {
 	f.BoolFunc("live", "reload server each time interval", settings.parseLiveFlag)
 	f.BoolFunc("l", "shorthand for 'live'", settings.parseLiveFlag)
 	minify := f.Bool("mini", false, "minify each page styles and scripts")
+	fresh := f.Bool("fresh", false, "rebuild everything ignoring the cache")
 
 	parseDefault(f, os.Args[2:], serveUsage)
 
@@ -96,6 +98,9 @@ func serveFlags() {
 	if minify != nil {
 		settings.Minify = *minify
 	}
+	if fresh != nil {
+		settings.Fresh = *fresh
+	}
 
 	if settings.reload == nil {
 		settings.LiveServer = ""
@@ -120,12 +125,16 @@ func buildFlags() {
 	var f = flag.NewFlagSet("build", flag.ExitOnError)
 
 	minify := f.Bool("mini", false, "minify each page styles and scripts")
+	fresh := f.Bool("fresh", false, "rebuild everything ignoring the cache")
 
 	parseDefault(f, os.Args[2:], buildUsage)
 
 	if minify != nil {
 		settings.Minify = *minify
 	}
+	if fresh != nil {
+		settings.Fresh = *fresh
+	}
 }
 
 func runFlags() {
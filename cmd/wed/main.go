@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	_ "embed"
 )
@@ -27,15 +28,17 @@ var (
 	defHttpScriptModuleContent []byte
 )
 
-func doInit() (err error) {
-	m := map[string][]byte{
-		settings.StylePath("wed-style"):                defStyleContent,
-		settings.ScriptPath("wed-utils.js"):            defScriptContent,
-		settings.ScriptPath("wed-utils.mjs"):           defScriptModuleContent,
-		settings.ScriptPath("wed-http.mjs"):            defHttpScriptModuleContent,
-		filepath.Join(settings.InputDir, "index.tmpl"): indexTemplate,
+// runtimeFiles are the files shipped with each site, written on the output directory
+func runtimeFiles() map[string][]byte {
+	return map[string][]byte{
+		settings.StylePath("wed-style"):      defStyleContent,
+		settings.ScriptPath("wed-utils.js"):  defScriptContent,
+		settings.ScriptPath("wed-utils.mjs"): defScriptModuleContent,
+		settings.ScriptPath("wed-http.mjs"):  defHttpScriptModuleContent,
 	}
+}
 
+func writeFiles(m map[string][]byte) (err error) {
 	for name, content := range m {
 		if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
 			return
@@ -44,6 +47,15 @@ func doInit() (err error) {
 			return
 		}
 	}
+	return
+}
+
+func doInit() (err error) {
+	m := runtimeFiles()
+	m[filepath.Join(settings.InputDir, "index.tmpl")] = indexTemplate
+	if err = writeFiles(m); err != nil {
+		return
+	}
 
 	if err = os.WriteFile(filepath.Join(settings.InputDir, "app.wed.html"), defaultAppComponent(), 0644); err == nil {
 		printlnDone("init", "Successfully created scaffolding project at", gray.Paint(settings.InputDir))
@@ -91,7 +103,8 @@ func doServe() error {
 		}()
 	}
 
-	http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./"+settings.OutputDir))))
+	base := settings.BasePath()
+	http.Handle(base, withHeaders(http.StripPrefix(strings.TrimSuffix(base, "/"), http.FileServer(http.Dir("./"+settings.OutputDir)))))
 
 	hint("Listening at: ", gray.Paint(settings.port), "\nServing directory: ", gray.Paint(settings.OutputDir), "\n")
 	return http.ListenAndServe(settings.port, nil)
@@ -58,36 +58,59 @@ function useDisplay(target, mutate) {
 		: (text) => (elem.innerText = text);
 }
 
+/**
+ * Fills the elements marked with the "data-prop" attribute with the given props.
+ * The attribute holds space separated prop names, optionally prefixed by the
+ * element property or attribute to set and ":" (default: textContent), like "title href:link".
+ * @param {ParentNode} root - The node containing the marked elements.
+ * @param {object} props - The values to fill, missing ones are left untouched.
+ */
+function fillProps(root, props) {
+	root.querySelectorAll("[data-prop]").forEach((elem) => {
+		elem.getAttribute("data-prop").split(/\s+/).forEach((spec) => {
+			const [target, name] = spec.includes(":") ? spec.split(":") : ["textContent", spec];
+			if (!(name in props)) return;
+			if (target in elem) elem[target] = props[name];
+			else elem.setAttribute(target, props[name]);
+		});
+	});
+}
+
 /**
  * @typedef {object} TemplateHandler
- * @property {() => Node} clone - Returns a new clone of the template.
- * @property {(target: Target) => Node} appendTo - Appends a new clone of the template as the last child of the specified target.
- * @property {(target: Target, before?: Target) => Node} insertTo - Inserts a new clone of the template on the specified target before another.
- * @property {(target: Target) => Node} replace - Replaces the specified target with a new clone of the template.
+ * @property {(props?: object) => Node} clone - Returns a new clone of the template.
+ * @property {(target: Target, props?: object) => Node} appendTo - Appends a new clone of the template as the last child of the specified target.
+ * @property {(target: Target, before?: Target, props?: object) => Node} insertTo - Inserts a new clone of the template on the specified target before another.
+ * @property {(target: Target, props?: object) => Node} replace - Replaces the specified target with a new clone of the template.
  */
 
 /**
  * Generates an object with methods to manage the provided template.
+ * Each clone is filled with the component declared props defaults, overwritten by
+ * the given props and then by the ones passed on each clone (see fillProps).
  * @param {string} templateID - The DOM id of the template to use.
- * @param {(cloned: Element) => void} [init] - Optional callback to initialize the template on each clone.
+ * @param {((cloned: Element) => void)|object} [init] - Optional callback to initialize the template on each clone or the props.
+ * @param {object} [props] - Optional props to fill each clone with.
  * @return {TemplateHandler} Utility methods for handling the template.
  */
-function useTemplate(templateID, init) {
+function useTemplate(templateID, init, props) {
+	if (typeof init === "object") [init, props] = [props, init];
+
 	const templ = document.getElementById(templateID);
-	const clone = !init
-		? () => templ.content.cloneNode(true)
-		: () => {
-			const elem = templ.content.cloneNode(true);
-			init(elem);
-			return elem;
-		};
+	const defaults = { ...JSON.parse(templ.dataset.props ?? "{}"), ...props };
+	const clone = (values) => {
+		const elem = templ.content.cloneNode(true);
+		fillProps(elem, { ...defaults, ...values });
+		if (!!init) init(elem);
+		return elem;
+	};
 
 	return {
 		clone,
-		appendTo: (target) => select(target).appendChild(clone()),
-		insertTo: (target, before = null) =>
-			select(target).insertBefore(clone(), select(before)),
-		replace: (target) => select(target).replaceWith(clone()),
+		appendTo: (target, values) => select(target).appendChild(clone(values)),
+		insertTo: (target, before = null, values) =>
+			select(target).insertBefore(clone(values), select(before)),
+		replace: (target, values) => select(target).replaceWith(clone(values)),
 	};
 }
 
@@ -182,6 +205,7 @@ window._wed_utility = {
 	useMirror,
 	useDisplay,
 	useTemplate,
+	fillProps,
 	useBinds,
 	useEffect,
 	bridge
@@ -1,2 +1,2 @@
-const { select, useMirror, useDisplay, useTemplate, useBinds, useEffect, bridge } = window._wed_utility
-export { select, useMirror, useDisplay, useTemplate, useBinds, useEffect, bridge }
+const { select, useMirror, useDisplay, useTemplate, fillProps, useBinds, useEffect, bridge } = window._wed_utility
+export { select, useMirror, useDisplay, useTemplate, fillProps, useBinds, useEffect, bridge }
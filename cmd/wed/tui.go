@@ -32,6 +32,15 @@ func printlnFailed(command string, vals ...any) {
 	fmt.Fprintln(os.Stderr, vals...)
 }
 
+func printlnWarning(vals ...any) {
+	if !brush.Disable {
+		fmt.Print(yellow.Paint(" ! "), " ")
+	} else {
+		fmt.Print("[!] ")
+	}
+	fmt.Fprintln(os.Stderr, vals...)
+}
+
 func printlnDone(command string, vals ...any) {
 	if settings.quiet {
 		return
@@ -74,6 +83,7 @@ var (
 	cyan    = brush.New(brush.BrightCyan, nil)
 	green   = brush.New(brush.BrightWhite, brush.UseColor(brush.BrightGreen))
 	red     = brush.New(brush.BrightWhite, brush.UseColor(brush.BrightRed))
+	yellow  = brush.New(brush.Black, brush.UseColor(brush.BrightYellow))
 )
 
 func mainUsage() {
@@ -144,8 +154,7 @@ func flagsUsage() string {
     If not exists 'build' is used as 'output_dir' and the current working directory as 'input_dir'
    -`, cyan.Paint("nc"), ` | --`, cyan.Paint("no-color"), ` Disable terminal colored output
    -`, cyan.Paint("q"), ` | --`, cyan.Paint("quiet"), ` Suppress most of feedback messages
-   -`, cyan.Paint("h"), ` | --`, cyan.Paint("help"), ` Display help and detailed usage of a specific command`), `
-`)
+   -`, cyan.Paint("h"), ` | --`, cyan.Paint("help"), ` Display help and detailed usage of a specific command`))
 
 }
 
@@ -160,7 +169,8 @@ Command flags:`, gray.Embed(`
 
    -`, cyan.Paint("l"), ` | --`, cyan.Paint("live"), ` Enable automatic rebuilding. If a non 0 time interval is specified, site will be rebuilt at that interval
     If nothing is specified site will be rebuilt on each changes detected from the 'input_dir' recursively (except for the 'output_dir')
-   -`, cyan.Paint("p"), ` | --`, cyan.Paint("port"), ` Specify the server port by default :8080 will be used. Character ':' at the beginning is optional`), `
+   -`, cyan.Paint("p"), ` | --`, cyan.Paint("port"), ` Specify the server port by default :8080 will be used. Character ':' at the beginning is optional
+  --`, cyan.Paint("fresh"), ` Rebuild everything ignoring the cache of the previous builds`), `
 
 `, flagsUsage())
 
@@ -201,6 +211,8 @@ Command flags:`, gray.Embed(`
   --`, cyan.Paint("mini"), ` Minify all styles and all suitables scripts of all components
    used by each page into single <page>-mini.css and <page>-mini.js files.
    By default only component generated files are minified and bundled by themselfs
+  --`, cyan.Paint("fresh"), ` Rebuild everything ignoring the cache of the previous builds.
+   By default only the pages and components changed since the last build are rebuilt
 
 `), flagsUsage())
 
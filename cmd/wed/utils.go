@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -61,7 +63,7 @@ func defaultShell() (sh, flag string) {
 	return
 }
 
-func watch(rootdir, builddir string, notify func() error) error {
+func watch(rootdir string, skip []string, notify func() error) error {
 	var watcher, err = fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -74,7 +76,7 @@ func watch(rootdir, builddir string, notify func() error) error {
 		}
 
 		if info.IsDir() {
-			if path == builddir {
+			if slices.Contains(skip, path) {
 				return filepath.SkipDir
 			}
 			watcher.Add(path)
@@ -91,7 +93,7 @@ func watch(rootdir, builddir string, notify func() error) error {
 
 			if event.Op.Has(fsnotify.Create) {
 				var info os.FileInfo
-				if info, err = os.Stat(event.Name); err == nil && info.IsDir() && event.Name != builddir {
+				if info, err = os.Stat(event.Name); err == nil && info.IsDir() && !slices.Contains(skip, event.Name) {
 					watcher.Add(event.Name)
 				}
 			}
@@ -109,6 +111,21 @@ func watch(rootdir, builddir string, notify func() error) error {
 	return err
 }
 
+// withHeaders sends the headers declared by the _headers file of the output directory,
+// read on each request so they follow the rebuilds
+func withHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers, err := engine.ReadHeaders(settings.OutputDir)
+		if err != nil {
+			hint("[Headers]", err)
+		}
+		for key, vals := range headers[r.URL.Path] {
+			w.Header()[key] = vals
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func useSSE(buildCh <-chan []error) {
 	var hub shared.SSEHandler
 
@@ -123,13 +140,13 @@ func useSSE(buildCh <-chan []error) {
 		}
 	}()
 
-	http.HandleFunc(settings.LiveServer, hub.Handler(&shared.SSEHandlerOpt{
+	http.HandleFunc(path.Join(settings.BasePath(), settings.LiveServer), hub.Handler(&shared.SSEHandlerOpt{
 		CrossOriginHeader: "*",
 		HandleErr:         func(e error) { hint("[Live Server]", e) },
 	}))
 }
 
-func each(reload time.Duration, rootdir, builddir string, notify func() error) error {
+func each(reload time.Duration, rootdir string, skip []string, notify func() error) error {
 	var tick = time.NewTicker(reload)
 	defer tick.Stop()
 
@@ -149,7 +166,7 @@ func each(reload time.Duration, rootdir, builddir string, notify func() error) e
 					edited = true
 					return filepath.SkipAll
 				}
-			} else if path == builddir {
+			} else if slices.Contains(skip, path) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -168,8 +185,32 @@ func each(reload time.Duration, rootdir, builddir string, notify func() error) e
 	return nil
 }
 
+// builder is shared by all the builds, so that live reloads only rebuild what changed
+var builder *engine.Builder
+
+// build writes the runtime files, so that the output directory can be wiped, and
+// reports the warnings of the build as they come, giving only its errors
 func build() chan error {
-	return engine.Build(settings.FileSettings.Settings)
+	if builder == nil {
+		builder = engine.NewBuilder(settings.FileSettings.Settings)
+	}
+
+	errch := make(chan error)
+	go func() {
+		defer close(errch)
+		if err := writeFiles(runtimeFiles()); err != nil {
+			errch <- fmt.Errorf("cannot write runtime files: %w", err)
+			return
+		}
+		for err := range builder.Build() {
+			if engine.IsWarning(err) {
+				printlnWarning(err)
+			} else {
+				errch <- err
+			}
+		}
+	}()
+	return errch
 }
 
 func liveReload() chan []error {
@@ -204,12 +245,16 @@ func liveReload() chan []error {
 		defer close(errch)
 		defer close(ssech)
 
-		var err error
+		var (
+			err error
+			// written by the builds themselves
+			skip = []string{settings.OutputDir, filepath.Dir(settings.CachePath()), settings.RemotePath()}
+		)
 		if *settings.reload == 0 {
-			if err = watch(settings.InputDir, settings.OutputDir, reload); err != nil {
+			if err = watch(settings.InputDir, skip, reload); err != nil {
 				err = fmt.Errorf("Live server stopped working cause %w", err)
 			}
-		} else if err = each(*settings.reload, settings.InputDir, settings.OutputDir, reload); err != nil {
+		} else if err = each(*settings.reload, settings.InputDir, skip, reload); err != nil {
 			err = fmt.Errorf("Live server stopped working cause %w", err)
 		}
 		if err != nil {
@@ -6,10 +6,15 @@ require (
 	github.com/DazFather/brush v0.0.0-20250528164247-02213676a6a7
 	github.com/evanw/esbuild v0.28.1
 	github.com/fsnotify/fsnotify v1.10.1
+	github.com/yuin/goldmark v1.8.6
+	github.com/yuin/goldmark-meta v1.1.0
+	golang.org/x/image v0.44.0
 	golang.org/x/net v0.56.0
+	golang.org/x/text v0.41.0
 )
 
 require (
 	golang.org/x/sys v0.46.0 // indirect
 	golang.org/x/term v0.44.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
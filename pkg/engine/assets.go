@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrMissingAsset = errors.New("missing asset")
+
+// publicDir gives the directory of the static assets, copied as they are on the output one
+func (s Settings) publicDir() string {
+	if s.PublicDir != "" {
+		return filepath.Clean(s.PublicDir)
+	}
+	return filepath.Join(s.InputDir, "public")
+}
+
+// publish copies the file at src to dest, if changed, and fingerprints it.
+// It gives the files written relative to the output directory
+func (s Settings) publish(src, dest string) ([]string, error) {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev, err := os.ReadFile(dest); err != nil || !bytes.Equal(prev, content) {
+		if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(dest, content, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	var files = []string{s.outputRel(dest)}
+	if fp, err := s.fingerprint(dest, content); err != nil {
+		return nil, err
+	} else if fp != "" {
+		files = append(files, s.outputRel(fp))
+	}
+	s.hashIntegrity(dest, content)
+	return files, nil
+}
+
+// copyPublic publishes all the files of the public directory, if any
+func (td *TemplateData) copyPublic() error {
+	var dir = td.publicDir()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files, err := td.publish(path, filepath.Join(td.OutputDir, rel))
+		if err != nil {
+			return fmt.Errorf("cannot copy asset %q: %w", path, err)
+		}
+		td.public = append(td.public, files...)
+		return nil
+	})
+}
+
+func isFile(fpath string) bool {
+	info, err := os.Stat(fpath)
+	return err == nil && !info.IsDir()
+}
+
+// findAsset gives the path of the asset relative to the public directory or, if not found,
+// to the input directory together with its output destination
+func (s Settings) findAsset(name string) (src, dest string, public bool, err error) {
+	var rel = filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		err = fmt.Errorf("asset %q must be relative to the public or input directory", name)
+		return
+	}
+
+	if src, dest = filepath.Join(s.publicDir(), rel), filepath.Join(s.OutputDir, rel); isFile(src) {
+		return src, dest, true, nil
+	}
+	if src, dest = filepath.Join(s.InputDir, rel), filepath.Join(s.OutputDir, "assets", rel); isFile(src) {
+		return src, dest, false, nil
+	}
+	err = fmt.Errorf("%w %q: not found in %q nor in %q", ErrMissingAsset, name, s.publicDir(), s.InputDir)
+	return
+}
+
+// asset is the 'asset' template function giving the URL of the asset at the given path,
+// see findAsset. The ones outside of the public directory are copied on demand
+// inside the "assets" output directory
+func (p *page) asset(name string) (string, error) {
+	src, dest, public, err := p.findAsset(name)
+	if err != nil {
+		return "", err
+	}
+
+	if !public {
+		files, err := p.publish(src, dest)
+		if err != nil {
+			return "", fmt.Errorf("cannot copy asset %q: %w", src, err)
+		}
+		p.assets = append(p.assets, files...)
+	}
+
+	p.track(src)
+	return rooted(p.fingerprinted(p.outputRel(dest))), nil
+}
+
+// track records the hash of a file the page depends on
+func (p *page) track(fpath string) {
+	if p.files == nil {
+		p.files = make(map[string]string)
+	}
+	p.files[fpath] = hashFile(fpath)
+}
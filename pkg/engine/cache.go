@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
+)
+
+// cacheVersion changes each time the cache format, or the way pages are built, does
+const cacheVersion = 7
+
+const (
+	cacheFile = ".wed-cache.json"
+	// stateDir holds what the builds keep for the following ones
+	stateDir = ".wed"
+)
+
+// PageEntry is what is known about a built page
+type PageEntry struct {
+	Hash     string `json:"hash"`
+	Location string `json:"location"`
+	// Components used by the page, with their hash at build time
+	Components map[string]string `json:"components,omitempty"`
+	// Layouts extended by the page, with their hash at build time
+	Layouts map[string]string `json:"layouts,omitempty"`
+	// Assets generated for the page, relative to the output directory
+	Assets []string `json:"assets,omitempty"`
+	// Fingerprints maps the assets to their fingerprinted copy
+	Fingerprints map[string]string `json:"fingerprints,omitempty"`
+	// Files read by the page (ex. using markdown), with their hash at build time
+	Files map[string]string `json:"files,omitempty"`
+	// Listed pages belong to the sitemap
+	Listed  bool   `json:"listed,omitempty"`
+	LastMod string `json:"lastmod,omitempty"`
+	// Feed is the page metadata used by the feeds
+	Feed FeedInfo `json:"feed,omitzero"`
+	// CSP is the Content-Security-Policy of the page
+	CSP string `json:"csp,omitempty"`
+	// Volatile pages depend on something that cannot be tracked (ex. embed) and are always rebuilt
+	Volatile bool `json:"volatile,omitempty"`
+}
+
+// Cache keeps track of the inputs of each component and page built
+type Cache struct {
+	Version    int                  `json:"version"`
+	Index      string               `json:"index"`
+	Components map[string]string    `json:"components"`
+	Pages      map[string]PageEntry `json:"pages"`
+	mu         sync.Mutex
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		Version:    cacheVersion,
+		Components: make(map[string]string),
+		Pages:      make(map[string]PageEntry),
+	}
+}
+
+// LoadCache reads the cache file, an empty one is given if missing or outdated
+func LoadCache(fpath string) (*Cache, error) {
+	var cache = NewCache()
+
+	content, err := os.ReadFile(fpath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	} else if err != nil {
+		return cache, err
+	}
+
+	var loaded Cache
+	if err = json.Unmarshal(content, &loaded); err != nil || loaded.Version != cacheVersion {
+		return cache, nil
+	}
+	if loaded.Components == nil {
+		loaded.Components = cache.Components
+	}
+	if loaded.Pages == nil {
+		loaded.Pages = cache.Pages
+	}
+	return &loaded, nil
+}
+
+func (c *Cache) Save(fpath string) error {
+	c.mu.Lock()
+	content, err := json.Marshal(c)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fpath, content, 0644)
+}
+
+func (c *Cache) setComponent(name, hash string) {
+	c.mu.Lock()
+	c.Components[name] = hash
+	c.mu.Unlock()
+}
+
+func (c *Cache) setPage(name string, entry PageEntry) {
+	c.mu.Lock()
+	c.Pages[name] = entry
+	c.mu.Unlock()
+}
+
+// CachePath gives the path of the build cache, by default inside the project state
+// directory so that it is never deployed together with the site
+func (s Settings) CachePath() string {
+	if s.CacheDir != "" {
+		return filepath.Join(s.CacheDir, cacheFile)
+	}
+	return filepath.Join(s.ProjectDir, stateDir, cacheFile)
+}
+
+func hashOf(vals ...any) string {
+	var h = sha256.New()
+	for _, val := range vals {
+		fmt.Fprintf(h, "%v\x00", val)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashFile(fpath string) string {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return ""
+	}
+	return hashOf(string(content))
+}
+
+func exists(fpath string) bool {
+	_, err := os.Stat(fpath)
+	return err == nil
+}
+
+// index is the hash of everything affecting all pages: settings and the names
+// of components and layouts, as they change the way names are resolved
+func (td *TemplateData) index() string {
+	var names = make([]string, 0, len(td.components)+len(td.layouts))
+	for _, c := range td.components {
+		names = append(names, "component:"+c.Name)
+	}
+	for name := range td.layouts {
+		names = append(names, "layout:"+name)
+	}
+	slices.Sort(names)
+
+	settings, _ := json.Marshal(td.Settings)
+	return hashOf(cacheVersion, string(settings), names, td.importsHash())
+}
+
+// componentUpToDate reports if the component output has been written with the same content
+func (td *TemplateData) componentUpToDate(c Component) bool {
+	if td.prev == nil || c.hash == "" || c.Type == element || td.prev.Components[c.Name] != c.hash {
+		return false
+	}
+	if c.Style != "" && !exists(td.StyleSource(c.slug())) {
+		return false
+	}
+	return c.Script == "" || exists(td.ScriptSource(c.slug()))
+}
+
+// hash of the page own inputs: template, data and translations
+func (p *page) hash() string {
+	var data = p.data
+	if pd, ok := data.(PageData); ok {
+		data = []any{pd.Meta, pd.Content}
+	}
+	return hashOf(p.source, data, p.locale, (*p.catalogs)[p.locale])
+}
+
+// pageUpToDate gives the entry of the page previous build if its inputs did not change
+func (td *TemplateData) pageUpToDate(p *page, hash string) (PageEntry, bool) {
+	if td.prev == nil {
+		return PageEntry{}, false
+	}
+
+	entry, found := td.prev.Pages[p.Name()]
+	if !found || entry.Volatile || entry.Hash != hash {
+		return entry, false
+	}
+
+	for name, h := range entry.Components {
+		i := slices.IndexFunc(td.components, func(c Component) bool { return c.Name == name })
+		if i < 0 || td.components[i].Type == element || td.components[i].hash != h {
+			return entry, false
+		}
+	}
+	for name, h := range entry.Layouts {
+		if td.layoutHashes[name] != h {
+			return entry, false
+		}
+	}
+	for fpath, h := range entry.Files {
+		if hashFile(fpath) != h {
+			return entry, false
+		}
+	}
+	for _, asset := range entry.Assets {
+		if !exists(filepath.Join(td.OutputDir, asset)) {
+			return entry, false
+		}
+	}
+
+	return entry, exists(filepath.Join(td.OutputDir, entry.Location))
+}
+
+// entry describes the page just built
+func (p *page) entry(hash string) PageEntry {
+	var entry = PageEntry{
+		Hash:         hash,
+		Location:     p.Location,
+		Components:   make(map[string]string),
+		Assets:       p.assets,
+		Fingerprints: p.fingerprintsOf(p.assets),
+		Files:        p.files,
+		Listed:       p.listed(),
+		LastMod:      p.lastMod(),
+		Feed:         p.feedInfo(),
+		Volatile:     p.volatile,
+	}
+
+	for _, dep := range util.Inverse(p.deps) {
+		if entry.Components[dep.Data.Name] = dep.Data.hash; dep.Data.hash == "" {
+			entry.Volatile = true
+		}
+	}
+
+	if len(p.layouts) > 0 {
+		entry.Layouts = make(map[string]string, len(p.layouts))
+		for _, name := range p.layouts {
+			entry.Layouts[name] = (*p.layoutHashes)[name]
+		}
+	}
+
+	return entry
+}
+
+// Builder keeps the state of the previous builds, rebuilding only what changed
+type Builder struct {
+	Settings
+	cache  *Cache
+	parsed map[string]Component
+}
+
+func NewBuilder(s Settings) *Builder {
+	return &Builder{Settings: s}
+}
+
+// Build walks the input directory and builds the site, the first time the cache
+// is loaded from disk (unless Fresh is set), then the one of the last build is used
+func (b *Builder) Build() chan error {
+	var (
+		td    = NewTemplateData(b.Settings)
+		errch = make(chan error)
+	)
+
+	td.reuse = b.parsed
+	if b.cache == nil && !b.Fresh {
+		// an unreadable cache is the same as a missing one
+		b.cache, _ = LoadCache(b.CachePath())
+	}
+
+	go func() {
+		defer close(errch)
+
+		failed := false
+		for err := range td.Walk() {
+			errch <- err
+			failed = true
+		}
+		if b.parsed = td.parsed; failed {
+			return
+		}
+
+		if td.prev = b.cache; td.prev != nil && td.prev.Index != td.index() {
+			td.prev = nil
+		}
+		td.next.Index = td.index()
+
+		for err := range td.Build() {
+			errch <- err
+			failed = failed || !IsWarning(err)
+		}
+		// the outputs of a failed build cannot be trusted
+		if failed {
+			return
+		}
+
+		b.cache = td.next
+		if err := td.next.Save(b.CachePath()); err != nil {
+			errch <- fmt.Errorf("cannot save build cache: %w", err)
+		}
+	}()
+
+	return errch
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Generator declares a page template rendered once per record of a data source
+type Generator struct {
+	// From is a JSON file (array of objects), a CSV file (with header)
+	// or a directory of JSON and Markdown files, each one being a record
+	From string `json:"from"`
+	// Path is the template of the output location of each page, like "products/{{ .slug }}.html"
+	Path string `json:"path"`
+}
+
+// LoadRecords reads all the records of the source
+func (g Generator) LoadRecords() ([]map[string]any, error) {
+	info, err := os.Stat(g.From)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadRecordsDir(g.From)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(g.From)); ext {
+	case ".json":
+		return loadRecordsJSON(g.From)
+	case ".csv":
+		return loadRecordsCSV(g.From)
+	default:
+		return nil, fmt.Errorf("unsupported data source %q, allowed only '.json', '.csv' or a directory", ext)
+	}
+}
+
+func loadRecordsJSON(fpath string) (records []map[string]any, err error) {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(content, &records); err != nil {
+		return nil, fmt.Errorf("expected an array of objects: %w", err)
+	}
+	for i := range records {
+		records[i] = fromJSON(records[i]).(map[string]any)
+	}
+	return
+}
+
+func loadRecordsCSV(fpath string) ([]map[string]any, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	var records = make([]map[string]any, len(rows)-1)
+	for i, row := range rows[1:] {
+		records[i] = make(map[string]any, len(row))
+		for j, key := range rows[0] {
+			records[i][key] = row[j]
+		}
+	}
+	return records, nil
+}
+
+// loadRecordsDir reads each JSON object or Markdown file (front matter and 'content')
+// inside the directory, their 'slug' defaults to the file name
+func loadRecordsDir(dir string) (records []map[string]any, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		var (
+			record  map[string]any
+			fpath   = filepath.Join(dir, entry.Name())
+			content []byte
+		)
+		if content, err = os.ReadFile(fpath); err != nil {
+			return
+		}
+
+		switch _, ext := splitExt(entry.Name()); ext {
+		case ".json":
+			if err = json.Unmarshal(content, &record); err != nil {
+				return nil, fmt.Errorf("cannot read record %q: %w", fpath, err)
+			}
+			record = fromJSON(record).(map[string]any)
+		case ".md":
+			var html template.HTML
+			if html, record, err = RenderMarkdown(content); err != nil {
+				return nil, fmt.Errorf("cannot render record %q: %w", fpath, err)
+			}
+			record["content"] = html
+		default:
+			continue
+		}
+
+		if _, found := record["slug"]; !found {
+			record["slug"], _ = splitExt(entry.Name())
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// isGeneratorSource reports if the file at path belongs to a generator data source
+func (td *TemplateData) isGeneratorSource(path string) bool {
+	for _, g := range td.Generate {
+		if rel, err := filepath.Rel(td.inputPath(g.From), path); err == nil && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// addGeneratedPages creates a page for each record of the generator using the template source read at path
+func (td *TemplateData) addGeneratedPages(path, name, source string, g Generator) error {
+	g.From = td.inputPath(g.From)
+	records, err := g.LoadRecords()
+	if err != nil {
+		return fmt.Errorf("cannot load records of %q from %q: %w", name, g.From, err)
+	}
+
+	locate, err := texttemplate.New(name).Option("missingkey=error").Parse(g.Path)
+	if err != nil {
+		return fmt.Errorf("invalid path of %q: %w", name, err)
+	}
+
+	var locations = make(map[string]int, len(records))
+	for i, record := range records {
+		var location strings.Builder
+		if err = locate.Execute(&location, record); err != nil {
+			return fmt.Errorf("cannot locate record %d of %q: %w", i+1, name, err)
+		}
+
+		loc := filepath.Clean(location.String())
+		if !filepath.IsLocal(loc) {
+			return fmt.Errorf("record %d of %q is located outside of the output directory at %q", i+1, name, loc)
+		}
+		if prev, found := locations[loc]; found {
+			return fmt.Errorf("records %d and %d of %q have the same location %q", prev, i+1, name, loc)
+		}
+		locations[loc] = i + 1
+
+		base, _ := splitExt(loc)
+		p := td.newPage(strings.ReplaceAll(filepath.ToSlash(base), "/", "-"))
+		p.data, p.source, p.file, p.Location = record, source, path, loc
+		if _, err = p.Parse(source); err != nil {
+			return fmt.Errorf("cannot parse page template %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -2,10 +2,14 @@ package engine
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -16,6 +20,10 @@ var (
 	ErrNoHTMLData       = errors.New("no 'html' data found")
 	ErrDuplicateTagData = errors.New("duplicate tag found")
 	ErrInvalidTypeAttr  = errors.New("invalid 'type' attribute")
+	ErrInvalidLangAttr  = errors.New("invalid 'lang' attribute")
+	ErrDuplicateName    = errors.New("duplicate component name")
+	ErrUnknownComponent = errors.New("unknown component")
+	ErrDuplicateLayout  = errors.New("duplicate layout name")
 
 	spaces = regexp.MustCompile(`(?s)\s+`)
 )
@@ -26,6 +34,7 @@ const (
 	static ComponentType = iota
 	dynamic
 	hybrid
+	element
 )
 
 func ParseComponentType(raw string) (ComponentType, error) {
@@ -36,22 +45,53 @@ func ParseComponentType(raw string) (ComponentType, error) {
 		return dynamic, nil
 	case "hybrid":
 		return hybrid, nil
+	case "element":
+		return element, nil
 	}
 
-	return 0, fmt.Errorf("%w '%s' allowed only 'static' (default), 'dynamic' and 'hybrid'", ErrInvalidTypeAttr, raw)
+	return 0, fmt.Errorf("%w '%s' allowed only 'static' (default), 'dynamic', 'hybrid' and 'element'", ErrInvalidTypeAttr, raw)
+}
+
+// ScriptLang is the language of a component script, transpiled to JavaScript by the build
+type ScriptLang string
+
+const (
+	langJS  ScriptLang = "js"
+	langTS  ScriptLang = "ts"
+	langJSX ScriptLang = "jsx"
+	langTSX ScriptLang = "tsx"
+)
+
+func ParseScriptLang(raw string) (ScriptLang, error) {
+	switch lang := ScriptLang(strings.ToLower(strings.Trim(raw, `"'`))); lang {
+	case "", "javascript", langJS:
+		return langJS, nil
+	case "typescript", langTS:
+		return langTS, nil
+	case langJSX, langTSX:
+		return lang, nil
+	}
+
+	return "", fmt.Errorf("%w '%s' allowed only 'js' (default), 'ts', 'jsx' and 'tsx'", ErrInvalidLangAttr, raw)
 }
 
 // Component struct to store extracted content
 type Component struct {
 	Module  *ModuleType
 	Name    string
+	Path    string
 	HTML    string
+	Head    string
 	Style   string
 	Script  string
+	Lang    ScriptLang
 	Imports []string
+	Props   []Prop
 	Type    ComponentType
 	Preload bool
 	Entry   bool
+	// hash of the source file, empty if unknown
+	hash string
 }
 
 func (c Component) String() string {
@@ -69,8 +109,40 @@ func (c Component) Identifier() string {
 	return c.Name
 }
 
+// slug is the component name safe to be used on file names, CSS classes and DOM ids
+func (c Component) slug() string {
+	return strings.ReplaceAll(c.Name, "/", "--")
+}
+
+// findComponent search a component by its name or, when directory-qualified
+// names are in use, by the last part of it as long as it is not ambiguous
+func findComponent(components []Component, name string) (Component, error) {
+	var found []Component
+	for _, c := range components {
+		if c.Name == name {
+			return c, nil
+		}
+		if !strings.Contains(name, "/") && path.Base(c.Name) == name {
+			found = append(found, c)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return Component{}, fmt.Errorf("%w %q", ErrUnknownComponent, name)
+	case 1:
+		return found[0], nil
+	}
+
+	paths := make([]string, len(found))
+	for i := range found {
+		paths[i] = found[i].Path
+	}
+	return Component{}, fmt.Errorf("ambiguous component name %q matching: %s, use the directory-qualified name instead", name, strings.Join(paths, ", "))
+}
+
 func ParseComponent(r io.Reader) (c Component, err error) {
-	parsed, err := shared.ParsePlainHtml(r, []string{"script", "style", "html"}, false)
+	parsed, err := shared.ParsePlainHtml(r, []string{"script", "style", "html", "props", "head"}, false)
 	if err != nil {
 		return
 	}
@@ -86,6 +158,14 @@ func ParseComponent(r io.Reader) (c Component, err error) {
 			}
 		case "style":
 			c.Style = block.InnerHTML
+		case "head":
+			c.Head = block.InnerHTML
+		case "props":
+			if c.Props, err = ParseProps(block.InnerHTML); err != nil {
+				return
+			} else if c.Props == nil {
+				c.Props = []Prop{}
+			}
 		case "script":
 			c.Script = block.InnerHTML
 			for _, attr := range block.Attrs {
@@ -96,6 +176,10 @@ func ParseComponent(r io.Reader) (c Component, err error) {
 					}
 				case "entrypoint": // TODO: find a better name
 					c.Entry = attr.Val == "" || strings.ToLower(attr.Val) == "true"
+				case "lang":
+					if c.Lang, err = ParseScriptLang(attr.Val); err != nil {
+						return
+					}
 				case "require":
 					c.Imports = spaces.Split(attr.Val, -1)
 				case "module":
@@ -111,6 +195,11 @@ func ParseComponent(r io.Reader) (c Component, err error) {
 
 	if c.HTML == "" {
 		err = ErrNoHTMLData
+	} else if err = c.checkDataProps(); err != nil {
+		return
+	} else if c.Type == element {
+		// custom elements must always be defined by the page
+		c.Entry = true
 	}
 
 	return
@@ -130,21 +219,43 @@ func (c Component) WrappedStyle() string {
 	if c.Style == "" {
 		return ""
 	}
-	return fmt.Sprintf(`.%v-component.wed-component{%v}`, c.Name, c.Style)
+	return fmt.Sprintf(`.%v-component.wed-component{%v}`, c.slug(), c.Style)
 }
 
 func (c Component) WrappedStaticHTML() string {
-	return fmt.Sprintf(`<div class="%v-component wed-component">%v</div>`, c.Name, c.HTML)
+	return fmt.Sprintf(`<div class="%v-component wed-component">%v</div>`, c.slug(), c.HTML)
 }
 
 func (c Component) WrappedDynamicHTML() string {
-	return fmt.Sprintf(`<template id="%v-component"><div class="%v-component wed-component">%v</div></template>`, c.Name, c.Name, c.HTML)
+	return fmt.Sprintf(`<template id="%v-component"%v><div class="%v-component wed-component">%v</div></template>`, c.slug(), c.propsAttr(), c.slug(), c.HTML)
+}
+
+// propsAttr gives the 'data-props' attribute holding the declared defaults
+// used by useTemplate when filling the clones
+func (c Component) propsAttr() string {
+	var defaults = c.defaults().props
+	if len(defaults) == 0 {
+		return ""
+	}
+
+	raw, err := json.Marshal(defaults)
+	if err != nil {
+		return ""
+	}
+	// braces are escaped to not be mistaken by template delimiters
+	return ` data-props="` + strings.ReplaceAll(template.HTMLEscapeString(string(raw)), "{", "&#123;") + `"`
 }
 
 func (c Component) WriteStyle(fpath string) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
 	return os.WriteFile(fpath, []byte(c.WrappedStyle()), os.ModePerm)
 }
 
 func (c Component) WriteScript(fpath string) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
 	return os.WriteFile(fpath, []byte(c.Script), os.ModePerm)
 }
@@ -0,0 +1,242 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	cspMeta    = "meta"
+	cspHeaders = "headers"
+
+	headersFile = "_headers"
+)
+
+// CSP declares the Content-Security-Policy of the built pages, allowing the inline
+// scripts, styles and event handlers of each one by their hash
+type CSP struct {
+	// Mode is "meta" to add a <meta http-equiv> to each page or "headers" to write
+	// a _headers file on the output directory, used by most static hosts
+	Mode string `json:"mode"`
+	// Directives extend the default policy, like {"img-src": ["https://cdn.example.com"]}
+	Directives map[string][]string `json:"directives,omitempty"`
+}
+
+func (c *CSP) UnmarshalJSON(raw []byte) error {
+	type plain CSP
+	if err := json.Unmarshal(raw, (*plain)(c)); err != nil {
+		return err
+	}
+
+	switch c.Mode {
+	case cspMeta, cspHeaders:
+		return nil
+	}
+	return errors.New("Unsupported csp mode '" + c.Mode + "', allowed only 'meta' or 'headers'")
+}
+
+var defaultCSP = []string{"default-src", "script-src", "style-src", "img-src", "object-src", "base-uri"}
+
+func hashSource(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// policy gives the policy of the page content, hashing its inline scripts and styles
+// and the event handlers and style attributes. It also gives the offset where the
+// <meta> declaring it belongs, right after the opening of <head> or, when present,
+// after the character encoding declaration that must stay within the first bytes
+func (c CSP) policy(content []byte) (string, int) {
+	var (
+		tokenizer       = html.NewTokenizer(bytes.NewReader(content))
+		scripts, styles []string
+		offset, metaAt  int
+		inline          string
+		directives      = make(map[string][]string)
+		appendUnique    = func(list []string, vals ...string) []string {
+			for _, val := range vals {
+				if !slices.Contains(list, val) {
+					list = append(list, val)
+				}
+			}
+			return list
+		}
+	)
+
+	// hashes of attributes are allowed only by 'unsafe-hashes' on their own directive
+	var unsafeScripts, unsafeStyles bool
+	// offset after the <meta> declaring the charset, -1 when not found before <body>
+	var charsetAt int
+
+	for ttype := tokenizer.Next(); ttype != html.ErrorToken; ttype = tokenizer.Next() {
+		offset += len(tokenizer.Raw())
+
+		switch ttype {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			tag := string(name)
+			switch {
+			case tag == "head", metaAt == 0 && tag == "html":
+				metaAt = offset
+			case tag == "body" && charsetAt == 0:
+				charsetAt = -1
+			}
+
+			inline = ""
+			if ttype == html.StartTagToken && (tag == "script" || tag == "style") {
+				inline = tag
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = tokenizer.TagAttr()
+				switch attr := string(key); {
+				case tag == "meta" && charsetAt == 0 && (attr == "charset" || attr == "http-equiv" && strings.EqualFold(string(val), "content-type")):
+					charsetAt = offset
+				case tag == "script" && attr == "src":
+					inline = ""
+				case strings.HasPrefix(attr, "on"):
+					scripts, unsafeScripts = appendUnique(scripts, hashSource(string(val))), true
+				case attr == "style":
+					styles, unsafeStyles = appendUnique(styles, hashSource(string(val))), true
+				}
+			}
+
+		case html.TextToken:
+			switch inline {
+			case "script":
+				scripts = appendUnique(scripts, hashSource(string(tokenizer.Raw())))
+			case "style":
+				styles = appendUnique(styles, hashSource(string(tokenizer.Raw())))
+			}
+			inline = ""
+
+		case html.DoctypeToken:
+			if metaAt == 0 {
+				metaAt = offset
+			}
+
+		default:
+			inline = ""
+		}
+	}
+
+	if charsetAt > metaAt {
+		metaAt = charsetAt
+	}
+	if unsafeScripts {
+		scripts = append([]string{"'unsafe-hashes'"}, scripts...)
+	}
+	if unsafeStyles {
+		styles = append([]string{"'unsafe-hashes'"}, styles...)
+	}
+	directives["default-src"] = []string{"'self'"}
+	directives["script-src"] = append([]string{"'self'"}, scripts...)
+	directives["style-src"] = append([]string{"'self'"}, styles...)
+	directives["img-src"] = []string{"'self'", "data:"}
+	directives["object-src"] = []string{"'none'"}
+	directives["base-uri"] = []string{"'self'"}
+
+	var names = slices.Clone(defaultCSP)
+	for _, name := range slices.Sorted(maps.Keys(c.Directives)) {
+		if directives[name] = appendUnique(directives[name], c.Directives[name]...); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	var res = make([]string, len(names))
+	for i, name := range names {
+		res[i] = strings.TrimSpace(name + " " + strings.Join(directives[name], " "))
+	}
+	return strings.Join(res, "; "), metaAt
+}
+
+// withPolicy gives the content with the <meta> declaring the policy at the given offset
+func withPolicy(content []byte, policy string, offset int) []byte {
+	var meta = `<meta http-equiv="Content-Security-Policy" content="` + strings.NewReplacer("&", "&amp;", `"`, "&quot;").Replace(policy) + `">`
+	return slices.Concat(content[:offset], []byte(meta), content[offset:])
+}
+
+// pagePaths gives the URL paths serving the page at location, under the base path
+func (s Settings) pagePaths(location string) []string {
+	var paths = []string{s.BasePath() + filepath.ToSlash(location)}
+	if path.Base(paths[0]) == "index.html" {
+		paths = append(paths, strings.TrimSuffix(paths[0], "index.html"))
+	}
+	return paths
+}
+
+// writeHeaders writes the _headers file with the policy of each page,
+// unless provided by the public directory
+func (td *TemplateData) writeHeaders() error {
+	if td.CSP == nil || td.CSP.Mode != cspHeaders || isFile(filepath.Join(td.publicDir(), headersFile)) {
+		return nil
+	}
+
+	var (
+		headers   strings.Builder
+		locations []string
+		policies  = make(map[string]string)
+	)
+	for _, entry := range td.next.Pages {
+		if entry.CSP != "" {
+			locations = append(locations, entry.Location)
+			policies[entry.Location] = entry.CSP
+		}
+	}
+	slices.Sort(locations)
+
+	for _, location := range locations {
+		for _, p := range td.pagePaths(location) {
+			headers.WriteString(p + "\n  Content-Security-Policy: " + policies[location] + "\n")
+		}
+	}
+	return os.WriteFile(filepath.Join(td.OutputDir, headersFile), []byte(headers.String()), 0644)
+}
+
+// ReadHeaders reads the headers of each URL path declared by the _headers file
+// of the output directory, if any
+func ReadHeaders(outputDir string) (map[string]http.Header, error) {
+	f, err := os.Open(filepath.Join(outputDir, headersFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		headers = make(map[string]http.Header)
+		scanner = bufio.NewScanner(f)
+		current http.Header
+	)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case line[0] != ' ' && line[0] != '\t':
+			if current = headers[trimmed]; current == nil {
+				current = make(http.Header)
+				headers[trimmed] = current
+			}
+		case current != nil:
+			if key, val, found := strings.Cut(trimmed, ":"); found {
+				current.Add(strings.TrimSpace(key), strings.TrimSpace(val))
+			}
+		}
+	}
+	return headers, scanner.Err()
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
+)
+
+var dataPropAttr = regexp.MustCompile(`data-prop\s*=\s*["']([^"']*)["']`)
+
+// dataProps lists the prop names targeted by the 'data-prop' attributes found on content.
+// Each attribute holds space separated prop names, optionally prefixed by the
+// element property or attribute they set and ':', like "title href:link"
+func dataProps(content string) (names []string) {
+	for _, match := range dataPropAttr.FindAllStringSubmatch(content, -1) {
+		for _, spec := range strings.Fields(match[1]) {
+			if _, name, found := strings.Cut(spec, ":"); found {
+				spec = name
+			}
+			if !slices.Contains(names, spec) {
+				names = append(names, spec)
+			}
+		}
+	}
+	return
+}
+
+// TagName is the custom element name of the component
+func (c Component) TagName() string {
+	return "wed-" + strings.ToLower(c.slug())
+}
+
+// elementTag renders the custom element tag using props as attributes and holds as children
+func (c Component) elementTag(info ComponentInfo) template.HTML {
+	var tag = "<" + c.TagName()
+	for _, key := range slices.Sorted(maps.Keys(info.props)) {
+		val, ok := info.props[key].(string)
+		if !ok {
+			raw, _ := json.Marshal(info.props[key])
+			val = string(raw)
+		}
+		tag += " " + key + `="` + template.HTMLEscapeString(val) + `"`
+	}
+	tag += ">"
+	for _, key := range slices.Sorted(maps.Keys(info.holds)) {
+		tag += string(info.holds[key])
+	}
+	return template.HTML(tag + "</" + c.TagName() + ">")
+}
+
+// elementScript generates the custom element definition from its rendered content,
+// the component own script will follow it
+func (c Component) elementScript(content, style string) string {
+	var observed = dataProps(content)
+	for _, prop := range c.Props {
+		if !slices.Contains(observed, prop.Name) {
+			observed = append(observed, prop.Name)
+		}
+	}
+
+	var (
+		rawTag, _      = json.Marshal(c.TagName())
+		rawObserved, _ = json.Marshal(observed)
+		rawShadow, _   = json.Marshal("<style>:host,.wed-component{display:contents}" + style + "</style>" + content)
+	)
+
+	return `customElements.define(` + string(rawTag) + `, class extends HTMLElement {
+	static observedAttributes = ` + string(rawObserved) + `;
+	constructor() {
+		super();
+		this.attachShadow({ mode: "open" }).innerHTML = ` + string(rawShadow) + `;
+	}
+	attributeChangedCallback(name, _, value) {
+		this.shadowRoot.querySelectorAll("[data-prop]").forEach((elem) => {
+			elem.getAttribute("data-prop").split(/\s+/).forEach((spec) => {
+				const [target, prop] = spec.includes(":") ? spec.split(":") : ["textContent", spec];
+				if (prop !== name) return;
+				if (target in elem) elem[target] = value;
+				else elem.setAttribute(target, value);
+			});
+		});
+	}
+});
+` + c.Script
+}
+
+// elementProps are the props the element content is rendered with at build time: the declared
+// defaults and, for the required ones, the zero value of their type until the attribute is set
+func (c Component) elementProps() ComponentInfo {
+	info := c.defaults()
+	info.hybrid = false
+	for _, prop := range c.Props {
+		if prop.Required {
+			if info.props == nil {
+				info.props = make(map[string]any, len(c.Props))
+			}
+			info.props[prop.Name] = prop.Type.zero()
+		}
+	}
+	return info
+}
+
+// elementRoot replaces the root marker on the element content, that can be loaded by pages
+// at any depth or by other sites, with the base URL or the root of the site
+func (s Settings) elementRoot() string {
+	if s.BaseURL != "" {
+		return s.rootPrefix("")
+	}
+	return "/"
+}
+
+// useElement renders the element content on the page only to collect the components used
+// inside it, so that the nested elements get defined as well
+func (p *page) useElement(c Component, data ComponentInfo) error {
+	info := c.elementProps()
+	info.merge(data)
+	return p.ExecuteTemplate(io.Discard, "wed-element-"+c.Name, info)
+}
+
+// renderElement executes the component template outside of any page
+// collecting the styles of the components used inside it
+func (td *TemplateData) renderElement(c Component) (string, error) {
+	var (
+		p       = td.initPage("wed-element-" + c.Name)
+		content strings.Builder
+		style   strings.Builder
+	)
+
+	p.addCollected()
+	if err := p.ExecuteTemplate(&content, "wed-element-"+c.Name, c.elementProps()); err != nil {
+		return "", err
+	}
+
+	for _, dep := range util.Inverse(p.deps) {
+		style.WriteString(dep.Data.WrappedStyle())
+	}
+	style.WriteString(c.WrappedStyle())
+
+	return c.elementScript(strings.ReplaceAll(content.String(), rootMarker, td.elementRoot()), style.String()), nil
+}
@@ -0,0 +1,374 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Feed declares an RSS 2.0 and Atom feed of a set of pages
+type Feed struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	// Dir selects the pages whose output location is inside it
+	Dir string `json:"dir,omitempty"`
+	// Tag selects the pages having it among the "tags" of their front matter or record
+	Tag string `json:"tag,omitempty"`
+	// Limit is the maximum number of items, the most recent ones are kept
+	Limit int `json:"limit,omitempty"`
+	// Content uses the rendered page body as content of the items
+	Content bool `json:"content,omitempty"`
+	// RSS and Atom are the output locations, by default "<name>.rss.xml" and "<name>.atom.xml"
+	RSS  string `json:"rss,omitempty"`
+	Atom string `json:"atom,omitempty"`
+}
+
+// FeedInfo is the metadata of a page used by the feeds
+type FeedInfo struct {
+	Title   string   `json:"title,omitempty"`
+	Summary string   `json:"summary,omitempty"`
+	Date    string   `json:"date,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// feedInfo reads the "title", "date" and "summary" (or "description") and "tags"
+// of the page front matter or record
+func (p *page) feedInfo() FeedInfo {
+	var info FeedInfo
+	if val, found := p.meta("title"); found {
+		info.Title = fmt.Sprint(val)
+	}
+	if val, found := p.meta("summary", "description"); found {
+		info.Summary = fmt.Sprint(val)
+	}
+	if t, found := p.date("date", "updated", "lastmod"); found {
+		info.Date = t.Format(time.RFC3339)
+	}
+
+	switch tags, _ := p.meta("tags"); v := tags.(type) {
+	case []any:
+		for _, tag := range v {
+			info.Tags = append(info.Tags, fmt.Sprint(tag))
+		}
+	case []string:
+		info.Tags = v
+	case string:
+		for tag := range strings.SplitSeq(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				info.Tags = append(info.Tags, tag)
+			}
+		}
+	}
+	return info
+}
+
+// readPageBody gives the title, description and body of the HTML page, the content
+// of the first <article> or <main> is preferred to the whole <body> and its links are
+// resolved against base
+func readPageBody(r io.Reader, base *url.URL) (title, description, body string) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return
+	}
+
+	var found = make(map[string]*html.Node)
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+
+		switch n.Data {
+		case "title", "article", "main", "body":
+			if found[n.Data] == nil {
+				found[n.Data] = n
+			}
+		case "meta":
+			var name, content string
+			for _, attr := range n.Attr {
+				switch attr.Key {
+				case "name":
+					name = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			if name == "description" {
+				description = content
+			}
+		}
+	}
+
+	if n := found["title"]; n != nil && n.FirstChild != nil {
+		title = strings.TrimSpace(n.FirstChild.Data)
+	}
+	for _, tag := range []string{"article", "main", "body"} {
+		if n := found[tag]; n != nil {
+			var buf strings.Builder
+			absolutize(n, base)
+			for child := range n.ChildNodes() {
+				html.Render(&buf, child)
+			}
+			if body = strings.TrimSpace(buf.String()); body != "" {
+				break
+			}
+		}
+	}
+	return
+}
+
+// absolutize resolves the links inside the node against the URL of its page,
+// so that they keep working once the content is moved into a feed
+func absolutize(node *html.Node, base *url.URL) {
+	resolve := func(link string) string {
+		ref, err := url.Parse(strings.TrimSpace(link))
+		if err != nil {
+			return link
+		}
+		return base.ResolveReference(ref).String()
+	}
+
+	for n := range node.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for i, attr := range n.Attr {
+			switch attr.Key {
+			case "href", "src", "poster":
+				n.Attr[i].Val = resolve(attr.Val)
+			case "srcset":
+				candidates := strings.Split(attr.Val, ",")
+				for j, candidate := range candidates {
+					if fields := strings.Fields(candidate); len(fields) > 0 {
+						fields[0] = resolve(fields[0])
+						candidates[j] = strings.Join(fields, " ")
+					}
+				}
+				n.Attr[i].Val = strings.Join(candidates, ", ")
+			}
+		}
+	}
+}
+
+type feedItem struct {
+	FeedInfo
+	url     string
+	date    time.Time
+	content string
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Description string `xml:"description,omitempty"`
+	Content     string `xml:"content:encoded,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName      xml.Name `xml:"rss"`
+	Version      string   `xml:"version,attr"`
+	XMLNSAtom    string   `xml:"xmlns:atom,attr"`
+	XMLNSContent string   `xml:"xmlns:content,attr"`
+	Channel      struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		Self          atomLink  `xml:"atom:link"`
+		LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+		Items         []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	ID      string    `xml:"id"`
+	Link    atomLink  `xml:"link"`
+	Updated string    `xml:"updated"`
+	Summary string    `xml:"summary,omitempty"`
+	Content *atomText `xml:"content,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Author   string      `xml:"author>name"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+// feedItems gives the pages selected by the feed, the most recent first
+func (td *TemplateData) feedItems(feed Feed) ([]feedItem, error) {
+	var items []feedItem
+	for _, entry := range td.next.Pages {
+		if feed.Dir != "" {
+			// the index of the directory lists the items, it is not one of them
+			rel, err := filepath.Rel(filepath.Clean(feed.Dir), entry.Location)
+			if err != nil || strings.HasPrefix(rel, "..") || rel == "index.html" {
+				continue
+			}
+		}
+		if feed.Tag != "" && !slices.Contains(entry.Feed.Tags, feed.Tag) {
+			continue
+		}
+
+		item := feedItem{FeedInfo: entry.Feed, url: td.pageURL(entry.Location)}
+		if item.date, _ = time.Parse(time.RFC3339, item.Date); item.Date == "" {
+			item.date, _ = time.Parse(time.DateOnly, entry.LastMod)
+		}
+
+		content, err := os.ReadFile(filepath.Join(td.OutputDir, entry.Location))
+		if err != nil {
+			return nil, err
+		}
+		base, err := url.Parse(strings.TrimSuffix(td.SiteURL, "/") + "/" + filepath.ToSlash(entry.Location))
+		if err != nil {
+			return nil, err
+		}
+		title, description, body := readPageBody(bytes.NewReader(content), base)
+		if item.Title == "" {
+			item.Title = title
+		}
+		if item.Summary == "" {
+			item.Summary = description
+		}
+		if feed.Content {
+			item.content = body
+		}
+		items = append(items, item)
+	}
+
+	slices.SortFunc(items, func(a, b feedItem) int {
+		if c := b.date.Compare(a.date); c != 0 {
+			return c
+		}
+		return strings.Compare(a.url, b.url)
+	})
+	if feed.Limit > 0 && len(items) > feed.Limit {
+		items = items[:feed.Limit]
+	}
+	return items, nil
+}
+
+func writeXML(fpath string, val any) error {
+	content, err := xml.MarshalIndent(val, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fpath, append([]byte(xml.Header), content...), 0644)
+}
+
+// writeFeed writes the RSS and Atom versions of the feed
+func (td *TemplateData) writeFeed(name string, feed Feed) error {
+	items, err := td.feedItems(feed)
+	if err != nil {
+		return err
+	}
+
+	if feed.RSS == "" {
+		feed.RSS = name + ".rss.xml"
+	}
+	if feed.Atom == "" {
+		feed.Atom = name + ".atom.xml"
+	}
+	if feed.Author == "" {
+		feed.Author = feed.Title
+	}
+
+	var (
+		home    = td.pageURL("")
+		updated time.Time
+		rss     = rssFeed{Version: "2.0", XMLNSAtom: "http://www.w3.org/2005/Atom", XMLNSContent: "http://purl.org/rss/1.0/modules/content/"}
+		atom    = atomFeed{
+			Title:    feed.Title,
+			Subtitle: feed.Description,
+			ID:       td.pageURL(feed.Atom),
+			Author:   feed.Author,
+			Links:    []atomLink{{Href: td.pageURL(feed.Atom), Rel: "self"}, {Href: home}},
+		}
+	)
+	if feed.Dir != "" {
+		home = td.pageURL(filepath.ToSlash(filepath.Clean(feed.Dir)) + "/")
+		atom.Links[1].Href = home
+	}
+
+	rss.Channel.Title, rss.Channel.Link, rss.Channel.Description = feed.Title, home, feed.Description
+	rss.Channel.Self = atomLink{Href: td.pageURL(feed.RSS), Rel: "self", Type: "application/rss+xml"}
+
+	for _, item := range items {
+		if item.date.After(updated) {
+			updated = item.date
+		}
+
+		ritem := rssItem{Title: item.Title, Link: item.url, GUID: item.url, Description: item.Summary, Content: item.content}
+		aentry := atomEntry{Title: item.Title, ID: item.url, Link: atomLink{Href: item.url}, Summary: item.Summary}
+		if !item.date.IsZero() {
+			ritem.PubDate = item.date.Format(time.RFC1123Z)
+			aentry.Updated = item.date.Format(time.RFC3339)
+		}
+		if item.content != "" {
+			aentry.Content = &atomText{Type: "html", Body: item.content}
+		}
+
+		rss.Channel.Items = append(rss.Channel.Items, ritem)
+		atom.Entries = append(atom.Entries, aentry)
+	}
+
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	rss.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	atom.Updated = updated.Format(time.RFC3339)
+	for i := range atom.Entries {
+		if atom.Entries[i].Updated == "" {
+			atom.Entries[i].Updated = atom.Updated
+		}
+	}
+
+	return errors.Join(
+		writeXML(filepath.Join(td.OutputDir, feed.RSS), rss),
+		writeXML(filepath.Join(td.OutputDir, feed.Atom), atom),
+	)
+}
+
+// writeFeeds writes all the declared feeds
+func (td *TemplateData) writeFeeds() error {
+	if len(td.Feeds) > 0 && td.SiteURL == "" {
+		return errors.New("feeds require the site_url setting")
+	}
+
+	for name, feed := range td.Feeds {
+		if err := td.writeFeed(name, feed); err != nil {
+			return fmt.Errorf("feed %q: %w", name, err)
+		}
+	}
+	return nil
+}
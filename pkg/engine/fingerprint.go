@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fingerprinted gives the URL of the fingerprinted copy of the file, if any
+func (s Settings) fingerprinted(link string) string {
+	if s.fingerprints != nil {
+		if fp, found := s.fingerprints.Load(link); found {
+			return fp
+		}
+	}
+	return link
+}
+
+// fingerprint writes a copy of the output file named after its content hash,
+// like "app-1a2b3c4d.js", giving its path. Nothing is done if fingerprinting is disabled
+func (s Settings) fingerprint(fpath string, content []byte) (string, error) {
+	if !s.Fingerprint || s.fingerprints == nil {
+		return "", nil
+	}
+
+	var (
+		sum = sha256.Sum256(content)
+		ext = filepath.Ext(fpath)
+		fp  = strings.TrimSuffix(fpath, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
+	)
+	if err := os.WriteFile(fp, content, 0644); err != nil {
+		return "", err
+	}
+
+	s.fingerprints.Store(s.outputRel(fpath), s.outputRel(fp))
+	return fp, nil
+}
+
+// prepareRuntime fingerprints and hashes the integrity of the runtime files, shipped
+// with each project, found on the output directory
+func (s Settings) prepareRuntime() error {
+	if !s.Fingerprint && !s.Integrity {
+		return nil
+	}
+
+	for _, fpath := range []string{
+		s.ScriptPath("wed-utils.js"),
+		s.ScriptPath("wed-utils.mjs"),
+		s.ScriptPath("wed-http.mjs"),
+		s.StylePath("wed-style.css"),
+	} {
+		content, err := os.ReadFile(fpath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if _, err = s.fingerprint(fpath, content); err != nil {
+			return err
+		}
+		s.hashIntegrity(fpath, content)
+	}
+	return nil
+}
+
+// fingerprintsOf gives the fingerprinted copies of the given output files
+func (s Settings) fingerprintsOf(files []string) map[string]string {
+	if s.fingerprints == nil {
+		return nil
+	}
+
+	var res map[string]string
+	for _, rel := range files {
+		if fp, found := s.fingerprints.Load(rel); found {
+			if res == nil {
+				res = make(map[string]string)
+			}
+			res[rel] = fp
+		}
+	}
+	return res
+}
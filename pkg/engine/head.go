@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// headKey identifies the elements that cannot be repeated on the page head
+func headKey(token html.Token) string {
+	var attr = func(name string) string {
+		for _, a := range token.Attr {
+			if a.Key == name {
+				return a.Val
+			}
+		}
+		return ""
+	}
+
+	switch token.Data {
+	case "title", "base":
+		return token.Data
+	case "meta":
+		if attr("charset") != "" {
+			return "meta:charset"
+		}
+		for _, name := range []string{"name", "property", "http-equiv"} {
+			if val := attr(name); val != "" {
+				return "meta:" + name + "=" + strings.ToLower(val)
+			}
+		}
+	case "link":
+		return "link:" + strings.ToLower(attr("rel")) + "=" + attr("href")
+	}
+	return ""
+}
+
+// mergeHead splits each content into its top-level elements removing duplicates.
+// Identical elements, or the ones with the same key (see headKey), are kept once
+// at the place of the first but using the last one content
+func mergeHead(contents ...string) string {
+	var (
+		order   []string
+		entries = make(map[string]string)
+		add     = func(key, entry string) {
+			if key == "" {
+				key = spaces.ReplaceAllString(entry, " ")
+			}
+			if _, found := entries[key]; !found {
+				order = append(order, key)
+			}
+			entries[key] = entry
+		}
+	)
+
+	for _, content := range contents {
+		var (
+			tokenizer = html.NewTokenizer(strings.NewReader(content))
+			current   strings.Builder
+			key       string
+			depth     int
+		)
+
+		for ttype := tokenizer.Next(); ttype != html.ErrorToken; ttype = tokenizer.Next() {
+			raw := string(tokenizer.Raw())
+			switch ttype {
+			case html.StartTagToken:
+				token := tokenizer.Token()
+				if depth == 0 {
+					key = headKey(token)
+				}
+				current.WriteString(raw)
+				if !isVoidElement(token.Data) {
+					depth++
+					continue
+				}
+			case html.SelfClosingTagToken:
+				if depth == 0 {
+					key = headKey(tokenizer.Token())
+				}
+				current.WriteString(raw)
+			case html.EndTagToken:
+				current.WriteString(raw)
+				if depth--; depth > 0 {
+					continue
+				}
+				depth = 0
+			case html.TextToken:
+				if depth > 0 {
+					current.WriteString(raw)
+					continue
+				} else if strings.TrimSpace(raw) == "" {
+					continue
+				}
+				current.WriteString(strings.TrimSpace(raw))
+			case html.CommentToken, html.DoctypeToken:
+				if depth > 0 {
+					current.WriteString(raw)
+				}
+				continue
+			}
+
+			if depth == 0 && current.Len() > 0 {
+				add(key, current.String())
+				current.Reset()
+				key = ""
+			}
+		}
+
+		if tokenizer.Err() == io.EOF && current.Len() > 0 {
+			add(key, current.String())
+		}
+	}
+
+	var res strings.Builder
+	for _, key := range order {
+		res.WriteString(entries[key])
+	}
+	return res.String()
+}
+
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
+
+func (p *page) genImportHead(heads []Component) func() (template.HTML, error) {
+	return func() (template.HTML, error) {
+		var contents, done []string
+		for _, c := range heads {
+			if slices.Contains(done, c.Name) {
+				continue
+			}
+			done = append(done, c.Name)
+
+			data, found := p.heads[c.Name]
+			if !found {
+				data = c.defaults()
+			}
+
+			var s strings.Builder
+			if err := p.ExecuteTemplate(&s, "wed-head-"+c.Name, componentPage{p, data}); err != nil {
+				return "", err
+			}
+			contents = append(contents, s.String())
+		}
+		return template.HTML(mergeHead(contents...)), nil
+	}
+}
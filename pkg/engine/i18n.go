@@ -0,0 +1,243 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// ErrMissingTranslation is reported, as a Warning, for the keys a catalog lacks
+var ErrMissingTranslation = errors.New("missing translations")
+
+var pluralForms = []string{"zero", "one", "two", "few", "many", "other"}
+
+// Catalog maps translation keys to their text or to their plural forms
+type Catalog map[string]any
+
+// LoadCatalog reads a JSON translation file, nested objects are flattened
+// joining their keys with '.' unless they hold plural forms (with at least "other")
+func LoadCatalog(fpath string) (Catalog, error) {
+	content, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err = json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	var catalog = make(Catalog)
+	return catalog, catalog.flatten("", raw)
+}
+
+func (c Catalog) flatten(prefix string, raw map[string]any) error {
+	for key, val := range raw {
+		switch v := val.(type) {
+		case string:
+			c[prefix+key] = v
+		case map[string]any:
+			if forms, ok := toPluralForms(v); ok {
+				c[prefix+key] = forms
+			} else if err := c.flatten(prefix+key+".", v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid translation %q, expected text or object", prefix+key)
+		}
+	}
+	return nil
+}
+
+func toPluralForms(raw map[string]any) (map[string]string, bool) {
+	if _, found := raw["other"]; !found {
+		return nil, false
+	}
+
+	var forms = make(map[string]string, len(raw))
+	for key, val := range raw {
+		text, ok := val.(string)
+		if !ok || !slices.Contains(pluralForms, key) {
+			return nil, false
+		}
+		forms[key] = text
+	}
+	return forms, true
+}
+
+var formNames = map[plural.Form]string{
+	plural.Zero: "zero",
+	plural.One:  "one",
+	plural.Two:  "two",
+	plural.Few:  "few",
+	plural.Many: "many",
+}
+
+// pluralForm gives the CLDR plural category of count on the given locale,
+// the "zero" form is also used for exactly 0 when the translation has it
+func pluralForm(lang language.Tag, count float64, forms map[string]string) string {
+	if _, found := forms["zero"]; found && count == 0 {
+		return "zero"
+	}
+
+	digits := strconv.FormatFloat(math.Abs(count), 'f', -1, 64)
+	integer, fraction, _ := strings.Cut(digits, ".")
+	i, _ := strconv.Atoi(integer[max(0, len(integer)-7):])
+	f, _ := strconv.Atoi(fraction)
+	if name, found := formNames[plural.Cardinal.MatchPlural(lang, i, len(fraction), len(fraction), f, f)]; found {
+		return name
+	}
+	return "other"
+}
+
+// Translate gives the text of key, using the "count" param to choose the plural form
+// following the rules of the locale, and replaces each {param} with its value
+func (c Catalog) Translate(locale, key string, params map[string]any) (string, bool) {
+	var text string
+	switch v := c[key].(type) {
+	case string:
+		text = v
+	case map[string]string:
+		text = v["other"]
+		if count, ok := toNumber(params["count"]); ok {
+			if val, found := v[pluralForm(language.Make(locale), count, v)]; found {
+				text = val
+			}
+		}
+	default:
+		return key, false
+	}
+
+	for name, val := range params {
+		text = strings.ReplaceAll(text, "{"+name+"}", fmt.Sprint(val))
+	}
+	return text, true
+}
+
+func toNumber(val any) (float64, bool) {
+	switch v := reflect.ValueOf(val); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// loadCatalogs reads the translations of each locale from "<translations>/<locale>.json"
+func (td *TemplateData) loadCatalogs() error {
+	td.catalogs = make(map[string]Catalog, len(td.Locales))
+	if td.DefaultLocale != "" && !slices.Contains(td.Locales, td.DefaultLocale) {
+		return fmt.Errorf("default locale %q is not listed on locales", td.DefaultLocale)
+	}
+	for _, locale := range td.Locales {
+		if _, err := language.Parse(locale); err != nil {
+			return fmt.Errorf("invalid locale %q: %w", locale, err)
+		}
+	}
+	if td.Translations == "" {
+		return nil
+	}
+
+	for _, locale := range td.Locales {
+		catalog, err := LoadCatalog(filepath.Join(td.inputPath(td.Translations), locale+".json"))
+		if err != nil {
+			return fmt.Errorf("cannot load translations of locale %q: %w", locale, err)
+		}
+		td.catalogs[locale] = catalog
+	}
+	return nil
+}
+
+// localize replaces each page with one for each locale, placed under its path prefix
+func (td *TemplateData) localize() error {
+	if len(td.Locales) == 0 {
+		return nil
+	}
+
+	var pages = make([]*page, 0, len(td.pages)*len(td.Locales))
+	for _, orig := range td.pages {
+		siblings := make([]*page, len(td.Locales))
+		for i, locale := range td.Locales {
+			p := td.initPage(orig.Name() + "-" + locale)
+			p.data, p.source, p.file, p.locale, p.siblings = orig.data, orig.source, orig.file, locale, siblings
+			p.id = len(pages) + i
+			p.Location = filepath.Join(p.localePrefix(), orig.Location)
+			if _, err := p.Parse(orig.source); err != nil {
+				return fmt.Errorf("cannot parse page %q for locale %q: %w", orig.Name(), locale, err)
+			}
+			siblings[i] = p
+		}
+		pages = append(pages, siblings...)
+	}
+	td.pages = pages
+
+	return nil
+}
+
+func (p *page) localePrefix() string {
+	if p.locale == p.DefaultLocale {
+		return ""
+	}
+	return p.locale
+}
+
+// translate is the 't' template function, params are given as key and value pairs.
+// Without locales the key itself is given
+func (p *page) translate(key string, params ...any) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("odd number of params translating %q", key)
+	}
+
+	var named = make(map[string]any, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		named[fmt.Sprint(params[i])] = params[i+1]
+	}
+
+	text, found := (*p.catalogs)[p.locale].Translate(p.locale, key, named)
+	if found || p.locale == "" {
+		return text, nil
+	}
+
+	if !slices.Contains(p.missing, key) {
+		p.missing = append(p.missing, key)
+	}
+	// falling back to the default locale, if any, or to the key itself
+	if p.DefaultLocale != "" && p.locale != p.DefaultLocale {
+		text, _ = (*p.catalogs)[p.DefaultLocale].Translate(p.DefaultLocale, key, named)
+	}
+	return text, nil
+}
+
+// Alternate is the page URL in another locale
+type Alternate struct {
+	Lang string
+	URL  string
+}
+
+// marker stands for the location of the page, on the content of its siblings,
+// until all pages have been built and their final location is known
+func (p *page) marker() string {
+	return "__wed_page_" + strconv.Itoa(p.id) + "__"
+}
+
+// hreflang is the template function listing the page URL in all locales
+func (p *page) hreflang() []Alternate {
+	var alts = make([]Alternate, len(p.siblings))
+	for i, sibling := range p.siblings {
+		alts[i] = Alternate{Lang: sibling.locale, URL: rooted(sibling.marker())}
+	}
+	return alts
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+var defaultImageWidths = []int{480, 960, 1440}
+
+const defaultImageSizes = "100vw"
+
+// imageVariant is a resized copy of an image
+type imageVariant struct {
+	path          string
+	width, height int
+}
+
+// imageVariants gives the variants of the image at each width smaller than its own, plus
+// the original size. Their names contain the hash of the source, so they are resized once
+func (s Settings) imageVariants(src string, content []byte) (variants []imageVariant, format string, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot read image %q: %w", src, err)
+	}
+
+	var ext string
+	switch format {
+	case "jpeg":
+		ext = ".jpg"
+	case "png":
+		ext = ".png"
+	default:
+		return nil, "", fmt.Errorf("unsupported image format %q of %q, allowed only jpeg or png", format, src)
+	}
+
+	widths := s.ImageWidths
+	if len(widths) == 0 {
+		widths = defaultImageWidths
+	}
+
+	var (
+		sum  = sha256.Sum256(content)
+		base = strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)) + "-" + hex.EncodeToString(sum[:4])
+	)
+	for _, w := range append(slices.Sorted(slices.Values(widths)), config.Width) {
+		if w <= 0 || w > config.Width || slices.ContainsFunc(variants, func(v imageVariant) bool { return v.width == w }) {
+			continue
+		}
+		variants = append(variants, imageVariant{
+			path:   filepath.Join(s.OutputDir, "images", base+"-"+strconv.Itoa(w)+ext),
+			width:  w,
+			height: max(1, (config.Height*w+config.Width/2)/config.Width),
+		})
+	}
+
+	return variants, format, nil
+}
+
+// writeImageVariants resizes the image writing the variants not found on the output directory
+func writeImageVariants(content []byte, format string, variants []imageVariant) error {
+	var img image.Image
+	for _, v := range variants {
+		if exists(v.path) {
+			continue
+		}
+
+		if img == nil {
+			var err error
+			if img, _, err = image.Decode(bytes.NewReader(content)); err != nil {
+				return err
+			}
+		}
+
+		var resized image.Image = img
+		if bounds := img.Bounds(); bounds.Dx() != v.width {
+			dst := image.NewRGBA(image.Rect(0, 0, v.width, v.height))
+			draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+			resized = dst
+		}
+
+		var buf bytes.Buffer
+		switch format {
+		case "jpeg":
+			if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85}); err != nil {
+				return err
+			}
+		case "png":
+			if err := png.Encode(&buf, resized); err != nil {
+				return err
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(v.path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(v.path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// image is the 'image' template function, giving a lazy loaded <img> of the asset
+// (see findAsset) with a variant for each configured width. The optional sizes
+// attribute defaults to the image_sizes setting
+func (p *page) image(name, alt string, sizes ...string) (template.HTML, error) {
+	src, _, _, err := p.findAsset(name)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+
+	variants, format, err := p.imageVariants(src, content)
+	if err != nil {
+		return "", err
+	}
+	if err = writeImageVariants(content, format, variants); err != nil {
+		return "", fmt.Errorf("cannot resize image %q: %w", src, err)
+	}
+	p.track(src)
+
+	var srcset = make([]string, len(variants))
+	for i, v := range variants {
+		rel := p.outputRel(v.path)
+		p.assets = append(p.assets, rel)
+		srcset[i] = rooted(rel) + " " + strconv.Itoa(v.width) + "w"
+	}
+
+	var size string
+	switch {
+	case len(sizes) > 0:
+		size = strings.Join(sizes, ", ")
+	case p.ImageSizes != "":
+		size = p.ImageSizes
+	default:
+		size = defaultImageSizes
+	}
+
+	largest := variants[len(variants)-1]
+	return template.HTML(fmt.Sprintf(
+		`<img src="%s" srcset="%s" sizes="%s" width="%d" height="%d" alt="%s" loading="lazy" decoding="async">`,
+		template.HTMLEscapeString(rooted(p.outputRel(largest.path))),
+		template.HTMLEscapeString(strings.Join(srcset, ", ")),
+		template.HTMLEscapeString(size),
+		largest.width,
+		largest.height,
+		template.HTMLEscapeString(alt),
+	)), nil
+}
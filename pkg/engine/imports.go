@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// importSource gives the local file or directory mapped to the bare specifier by the imports setting
+func (s Settings) importSource(specifier string) string {
+	return filepath.Join(s.InputDir, filepath.FromSlash(s.Imports[specifier]))
+}
+
+// isImportSource reports if the directory is mapped by the imports setting, so it is not walked
+func (s Settings) isImportSource(dir string) bool {
+	for specifier := range s.Imports {
+		if filepath.Clean(dir) == s.importSource(specifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// aliases gives the esbuild aliases of the runtime modules and of the imports setting
+func (s Settings) aliases() map[string]string {
+	var alias = map[string]string{
+		"@wed/utils": "./" + filepath.ToSlash(s.ScriptPath("wed-utils.mjs")),
+		"@wed/http":  "./" + filepath.ToSlash(s.ScriptPath("wed-http.mjs")),
+	}
+	for specifier := range s.Imports {
+		// subpaths of the directories are aliased too
+		alias[strings.TrimSuffix(specifier, "/")] = "./" + filepath.ToSlash(s.importSource(specifier))
+	}
+	return alias
+}
+
+// importMap gives the entries of the import map, the runtime modules and the imports setting
+func (s Settings) importMap() map[string]string {
+	var entries = map[string]string{
+		"@wed/utils": s.ScriptURL("wed-utils.mjs"),
+		"@wed/http":  s.ScriptURL("wed-http.mjs"),
+	}
+	maps.Copy(entries, s.importURLs)
+	return entries
+}
+
+// vendorPath gives the path inside the "vendor" output directory of the import source,
+// named after the specifier (ex. "lit/" becomes "vendor/lit") keeping the file extension
+func vendorPath(specifier, src string) string {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimSuffix(specifier, "/")), "/")
+	if ext := filepath.Ext(src); !strings.HasSuffix(specifier, "/") && path.Ext(name) != ext {
+		name += ext
+	}
+	return filepath.Join("vendor", filepath.FromSlash(name))
+}
+
+// copyImports publishes the files and directories of the imports setting inside
+// the "vendor" output directory, unless they belong to the public one
+func (td *TemplateData) copyImports() error {
+	var dests = make(map[string]string, len(td.Imports))
+
+	td.importURLs = make(map[string]string, len(td.Imports))
+	for _, specifier := range slices.Sorted(maps.Keys(td.Imports)) {
+		src := td.importSource(specifier)
+		info, err := os.Stat(src)
+		if err != nil {
+			return fmt.Errorf("import %q: %w", specifier, err)
+		}
+		if info.IsDir() != strings.HasSuffix(specifier, "/") {
+			return fmt.Errorf("import %q: directories must be mapped by specifiers ending with '/' and files by the others", specifier)
+		}
+
+		dest := filepath.Join(td.OutputDir, vendorPath(specifier, src))
+		if rel, err := filepath.Rel(td.publicDir(), src); err == nil && !strings.HasPrefix(rel, "..") {
+			dest = filepath.Join(td.OutputDir, rel)
+		} else if prev, found := dests[dest]; found {
+			return fmt.Errorf("imports %q and %q are both copied to %q", prev, specifier, dest)
+		}
+		dests[dest] = specifier
+
+		if !info.IsDir() {
+			files, err := td.publish(src, dest)
+			if err != nil {
+				return fmt.Errorf("import %q: %w", specifier, err)
+			}
+			td.public = append(td.public, files...)
+			td.importURLs[specifier] = rooted(td.fingerprinted(td.outputRel(dest)))
+			continue
+		}
+
+		err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			files, err := td.publish(path, filepath.Join(dest, rel))
+			td.public = append(td.public, files...)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("import %q: %w", specifier, err)
+		}
+		td.importURLs[specifier] = rooted(td.outputRel(dest) + "/")
+	}
+	return nil
+}
+
+// importsHash hashes the content of the imports setting sources, bundled in the page scripts
+func (s Settings) importsHash() string {
+	var hashes []string
+	for _, specifier := range slices.Sorted(maps.Keys(s.Imports)) {
+		filepath.WalkDir(s.importSource(specifier), func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				hashes = append(hashes, path+":"+hashFile(path))
+			}
+			return nil
+		})
+	}
+	return hashOf(hashes)
+}
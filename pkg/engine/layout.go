@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"text/template/parse"
+)
+
+// extendsOf gives the name of the layout declared by the template using {{ extends "name" }}
+func extendsOf(t *template.Template) (string, bool) {
+	if t == nil || t.Tree == nil {
+		return "", false
+	}
+
+	for _, node := range t.Tree.Root.Nodes {
+		action, ok := node.(*parse.ActionNode)
+		if !ok || action.Pipe == nil || len(action.Pipe.Cmds) != 1 {
+			continue
+		}
+
+		args := action.Pipe.Cmds[0].Args
+		if len(args) != 2 {
+			continue
+		}
+		if ident, ok := args[0].(*parse.IdentifierNode); ok && ident.Ident == "extends" {
+			if name, ok := args[1].(*parse.StringNode); ok {
+				return name.Text, true
+			}
+		}
+	}
+	return "", false
+}
+
+// AddLayout parses a layout template, available to the pages as {{ extends "name" }}
+func (td *TemplateData) AddLayout(name, source string) error {
+	if _, found := td.layouts[name]; found {
+		return fmt.Errorf("%w %q", ErrDuplicateLayout, name)
+	}
+
+	t, err := template.New("wed-layout-" + name).Funcs(mockFuncs()).Parse(source)
+	if err == nil {
+		td.layouts[name], td.layoutHashes[name] = t, hashOf(source)
+	}
+	return err
+}
+
+// applyLayouts adds to the page all the templates of the layouts it extends, the
+// ones already defined by the page or by a nearer layout are kept.
+// It returns the name of the template to execute
+func (p *page) applyLayouts() (string, error) {
+	p.layouts = nil
+
+	name, found := extendsOf(p.Template)
+	if !found {
+		return p.Name(), nil
+	}
+
+	for found {
+		if slices.Contains(p.layouts, name) {
+			return "", fmt.Errorf("detected circular layouts: %v", append(p.layouts, name))
+		}
+
+		layout, ok := (*p.layoutSet)[name]
+		if !ok {
+			return "", fmt.Errorf("page %q extends unknown layout %q", p.Name(), name)
+		}
+		p.layouts = append(p.layouts, name)
+
+		// trees are copied as the escaper modifies them when executing the page
+		for _, t := range layout.Templates() {
+			if p.Lookup(t.Name()) == nil {
+				if _, err := p.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+					return "", err
+				}
+			}
+		}
+
+		name, found = extendsOf(layout)
+	}
+
+	return "wed-layout-" + p.layouts[len(p.layouts)-1], nil
+}
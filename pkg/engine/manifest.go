@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const manifestFile = "wed-manifest.json"
+
+// Asset is a file written on the output directory
+type Asset struct {
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ManifestPage describes a built page
+type ManifestPage struct {
+	Location string `json:"location"`
+	Asset
+	// Components used by the page, directly or required by other components
+	Components []string `json:"components"`
+	// Assets are the styles, scripts and source maps generated for the page
+	Assets []string `json:"assets"`
+}
+
+// ManifestComponent describes the files written for a component
+type ManifestComponent struct {
+	Source string   `json:"source,omitempty"`
+	Assets []string `json:"assets"`
+}
+
+// Manifest lists everything produced by a build, all paths are relative to the output directory
+type Manifest struct {
+	Pages      map[string]ManifestPage      `json:"pages"`
+	Components map[string]ManifestComponent `json:"components"`
+	Assets     map[string]Asset             `json:"assets"`
+	// Fingerprints maps the emitted files to their fingerprinted copy, if enabled
+	Fingerprints map[string]string `json:"fingerprints,omitempty"`
+}
+
+func (s Settings) readAsset(rel string) (Asset, error) {
+	content, err := os.ReadFile(filepath.Join(s.OutputDir, filepath.FromSlash(rel)))
+	if err != nil {
+		return Asset{}, err
+	}
+
+	sum := sha256.Sum256(content)
+	return Asset{Size: len(content), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// manifest describes the build using the cache entries of the pages,
+// sizes and hashes are read from the output directory
+func (td *TemplateData) manifest() (*Manifest, error) {
+	var m = Manifest{
+		Pages:      make(map[string]ManifestPage, len(td.next.Pages)),
+		Components: make(map[string]ManifestComponent, len(td.components)),
+		Assets:     make(map[string]Asset),
+	}
+
+	var addAssets = func(paths []string) error {
+		for _, rel := range paths {
+			if _, found := m.Assets[rel]; found {
+				continue
+			}
+			asset, err := td.readAsset(rel)
+			if err != nil {
+				return err
+			}
+			m.Assets[rel] = asset
+		}
+		return nil
+	}
+
+	var addFingerprint = func(orig, fp string) bool {
+		if m.Fingerprints == nil {
+			m.Fingerprints = make(map[string]string)
+		}
+		m.Fingerprints[orig] = fp
+		return true
+	}
+
+	for name, entry := range td.next.Pages {
+		page := ManifestPage{
+			Location:   filepath.ToSlash(entry.Location),
+			Components: slices.Sorted(maps.Keys(entry.Components)),
+			Assets:     entry.Assets,
+		}
+		if page.Components == nil {
+			page.Components = []string{}
+		}
+		if page.Assets == nil {
+			page.Assets = []string{}
+		}
+
+		var err error
+		if page.Asset, err = td.readAsset(page.Location); err != nil {
+			return nil, err
+		}
+		if err = addAssets(page.Assets); err != nil {
+			return nil, err
+		}
+		m.Pages[name] = page
+
+		for orig, fp := range entry.Fingerprints {
+			addFingerprint(orig, fp)
+		}
+	}
+	td.fingerprints.Range(addFingerprint)
+
+	if err := addAssets(td.public); err != nil {
+		return nil, err
+	}
+
+	for _, c := range td.components {
+		comp := ManifestComponent{Source: filepath.ToSlash(c.Path), Assets: []string{}}
+		// written only when used by a page without minify, otherwise bundled with it
+		if c.Style != "" && c.Type != element && exists(td.StylePath(c.slug())) {
+			comp.Assets = append(comp.Assets, td.outputRel(td.StylePath(c.slug())))
+		}
+		if (c.Script != "" || c.Type == element) && exists(td.ScriptPath(c.slug())) {
+			comp.Assets = append(comp.Assets, td.outputRel(td.ScriptPath(c.slug())))
+		}
+		if err := addAssets(comp.Assets); err != nil {
+			return nil, err
+		}
+		m.Components[c.Name] = comp
+	}
+
+	return &m, nil
+}
+
+// writeManifest writes the manifest of the build on the output directory
+func (td *TemplateData) writeManifest() error {
+	m, err := td.manifest()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(td.OutputDir, manifestFile), content, 0644)
+}
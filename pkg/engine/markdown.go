@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, meta.Meta),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+// PageData is the data given to the page templates, Meta and Content are only
+// available on pages generated from Markdown files
+type PageData struct {
+	*TemplateData
+	Meta    map[string]any
+	Content template.HTML
+}
+
+// RenderMarkdown converts the Markdown source into HTML returning its front matter, if any.
+// Headings will have an id generated from their text to be linked
+func RenderMarkdown(source []byte) (content template.HTML, frontMatter map[string]any, err error) {
+	var (
+		buf bytes.Buffer
+		ctx = parser.NewContext()
+	)
+
+	if err = markdown.Convert(source, &buf, parser.WithContext(ctx)); err != nil {
+		return
+	}
+	if frontMatter, err = meta.TryGet(ctx); err == nil && frontMatter == nil {
+		frontMatter = make(map[string]any)
+	}
+	return template.HTML(buf.String()), frontMatter, err
+}
+
+// markdown is the page 'markdown' function, the given source can be either
+// Markdown text or the path of a .md file relative to the input directory
+func (p *page) markdown(source string) (template.HTML, error) {
+	var raw = []byte(source)
+	if strings.ToLower(filepath.Ext(source)) == ".md" {
+		fpath := filepath.Join(p.InputDir, source)
+		content, err := os.ReadFile(fpath)
+		if err != nil {
+			return "", fmt.Errorf("cannot read markdown %q: %w", source, err)
+		}
+		p.track(fpath)
+		raw = content
+	}
+
+	content, _, err := RenderMarkdown(raw)
+	return content, err
+}
+
+const markdownSkeleton = `<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		{{ with .Meta.title }}<title>{{ . }}</title>{{ end }}
+		{!{ import "head" }!}
+		{!{ import "styles" }!}
+		{!{ import "scripts" }!}
+	</head>
+	<body>
+		{!{ import "dynamics" }!}
+		%s
+	</body>
+</html>`
+
+// markdownSource gives the page template wrapping the content using the given layout,
+// that can be either the name of a layout, a page or a component
+func (td *TemplateData) markdownSource(layout string) (string, error) {
+	if layout == "" {
+		return fmt.Sprintf(markdownSkeleton, "{{ .Content }}"), nil
+	}
+
+	if _, found := td.layouts[layout]; found {
+		return `{{ extends "` + layout + `" }}`, nil
+	}
+
+	for _, p := range td.pages {
+		if p.Name() == layout {
+			return p.source, nil
+		}
+	}
+
+	c, err := findComponent(td.components, layout)
+	if err != nil {
+		return "", fmt.Errorf("layout %q is neither a layout, a page or a component: %w", layout, err)
+	}
+	return fmt.Sprintf(markdownSkeleton, `{{ use "`+c.Name+`" (args "content" .Content "meta" .Meta) }}`), nil
+}
+
+// contentDir gives the directory whose Markdown files are all turned into pages, if any
+func (s Settings) contentDir() string {
+	if s.ContentDir == "" {
+		return ""
+	}
+	return filepath.Join(s.InputDir, s.ContentDir)
+}
+
+// isMarkdownPage reports if the Markdown file at path is a page: either it is inside the
+// content directory or its front matter opts in with 'page' set to true or to a location
+func (td *TemplateData) isMarkdownPage(path string, frontMatter map[string]any) bool {
+	switch val := frontMatter["page"].(type) {
+	case nil:
+		dir := td.contentDir()
+		if dir == "" {
+			return false
+		}
+		rel, err := filepath.Rel(dir, path)
+		return err == nil && !strings.HasPrefix(rel, "..")
+	case bool:
+		return val
+	}
+	return true
+}
+
+// addMarkdownPage creates a page from the Markdown file at the given path, placed at the
+// same path relative to the input directory unless the front matter gives its location
+func (td *TemplateData) addMarkdownPage(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read markdown page %q: %w", path, err)
+	}
+
+	content, frontMatter, err := RenderMarkdown(raw)
+	if err != nil {
+		return fmt.Errorf("cannot render markdown page %q: %w", path, err)
+	}
+	if !td.isMarkdownPage(path, frontMatter) {
+		return nil
+	}
+
+	layout := td.MarkdownLayout
+	if val, ok := frontMatter["layout"]; ok {
+		layout = fmt.Sprint(val)
+	}
+
+	source, err := td.markdownSource(layout)
+	if err != nil {
+		return fmt.Errorf("cannot wrap markdown page %q: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(td.InputDir, path)
+	if err != nil {
+		return err
+	}
+	base, _ := splitExt(rel)
+
+	p := td.newPage(strings.ReplaceAll(filepath.ToSlash(base), "/", "-"))
+	p.data = PageData{TemplateData: td, Meta: frontMatter, Content: content}
+	p.Location = base + ".html"
+	if location, ok := frontMatter["page"].(string); ok {
+		p.Location = location
+	}
+	if _, err = p.Parse(source); err != nil {
+		return fmt.Errorf("cannot parse markdown page %q: %w", path, err)
+	}
+	p.source, p.file = source, path
+
+	return nil
+}
@@ -2,8 +2,12 @@ package engine
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"maps"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 
@@ -13,50 +17,100 @@ import (
 type ComponentDependency = util.Dependency[string, Component]
 
 type page struct {
-	components *[]Component
-	collected  **template.Template
+	components   *[]Component
+	collected    **template.Template
+	layoutSet    *map[string]*template.Template
+	catalogs     *map[string]Catalog
+	layoutHashes *map[string]string
 	*Settings
 	*template.Template
 	deps     []ComponentDependency
+	layouts  []string
+	data     any
+	source   string
+	file     string
+	locale   string
+	siblings []*page
+	id       int
+	missing  []string
+	files    map[string]string
+	volatile bool
+	assets   []string
+	unlisted bool
+	heads    map[string]ComponentInfo
 	Location string
 }
 
+// componentPage is given to the dynamic and head templates of the components,
+// exposing the page together with the props
+type componentPage struct {
+	*page
+	ComponentInfo
+}
+
 func (td *TemplateData) newPage(name string) *page {
+	var p = td.initPage(name)
+	td.pages = append(td.pages, p)
+	return p
+}
+
+// initPage creates a page without adding it to the ones to build
+func (td *TemplateData) initPage(name string) *page {
 	var p = page{
-		components: &td.components,
-		Settings:   &td.Settings,
-		collected:  &td.collected,
-		Location:   name + ".html",
+		components:   &td.components,
+		Settings:     &td.Settings,
+		collected:    &td.collected,
+		layoutSet:    &td.layouts,
+		catalogs:     &td.catalogs,
+		layoutHashes: &td.layoutHashes,
+		data:         PageData{TemplateData: td},
+		Location:     name + ".html",
 	}
 	p.Template = template.New(name).Funcs(template.FuncMap{
 		"list": func(v ...any) []any { return v },
 		"embed": func(link string) (emb template.HTML, err error) {
+			p.volatile = true
 			content, err := util.FetchContent(link)
 			if err == nil {
 				emb = template.HTML(content)
 			}
 			return
 		},
-		"use":  p.use,
-		"args": p.args,
-		"hold": p.hold,
-		"drop": p.drop,
-		"var":  p.getVar,
+		"use":      p.use,
+		"args":     p.args,
+		"hold":     p.hold,
+		"drop":     p.drop,
+		"var":      p.getVar,
+		"markdown": p.markdown,
+		"extends":  func(string) string { return "" },
+		"t":        p.translate,
+		"lang":     func() string { return p.locale },
+		"hreflang": p.hreflang,
+		"asset":    p.asset,
+		"image":    p.image,
+		"sri":      p.sri,
 	})
 
-	td.pages = append(td.pages, &p)
-
 	return &p
 }
 
+// addCollected makes all the component templates available to the page
+func (p *page) addCollected() {
+	for _, c := range (*p.collected).Templates() {
+		p.AddParseTree(c.Name(), c.Tree)
+	}
+}
+
 func (p *page) Build(data any) ([]byte, error) {
 	var buf bytes.Buffer
 
 	// Run first template engine
-	for _, c := range (*p.collected).Templates() {
-		p.AddParseTree(c.Name(), c.Tree)
+	p.addCollected()
+	main, err := p.applyLayouts()
+	if err != nil {
+		return nil, err
 	}
-	if err := p.Template.Execute(&buf, data); err != nil {
+	if err := p.ExecuteTemplate(&buf, main, data); err != nil {
 		return nil, err
 	}
 
@@ -68,43 +122,80 @@ func (p *page) Build(data any) ([]byte, error) {
 			err = templ.Execute(&buf, p)
 		}
 	}
-	return buf.Bytes(), err
+	return bytes.ReplaceAll(buf.Bytes(), []byte(rootMarker), []byte(p.rootPrefix(p.Location))), err
 }
 
-func (p *page) genImportDynamic(dynamics []string) func() template.HTML {
+func (p *page) genImportDynamic(dynamics []Component) func() template.HTML {
 	if len(dynamics) == 0 {
 		return func() template.HTML { return "" }
 	}
 
 	return func() template.HTML {
-		s := new(strings.Builder)
-		for _, name := range util.Compact(dynamics) {
-			p.ExecuteTemplate(s, "wed-dynamic-"+name, p)
+		var (
+			s    = new(strings.Builder)
+			done []string
+		)
+		for _, c := range dynamics {
+			if !slices.Contains(done, c.Name) {
+				done = append(done, c.Name)
+				p.ExecuteTemplate(s, "wed-dynamic-"+c.Name, componentPage{p, c.defaults()})
+			}
 		}
 		return template.HTML(s.String())
 	}
 }
 
-func (p *page) genImportStyle(styles []string) (func() template.HTML, error) {
-	var tags string = p.StyleTag("wed-style")
+func (p *page) genImportStyle(styles []string) (func() template.HTML, []string, []string, error) {
+	var tags = p.runtimeTag("style", "", p.StylePath("wed-style.css"), p.StyleTag("wed-style"))
+	if p.CriticalCSS {
+		tags = p.DeferredStyleTag("wed-style")
+	}
 
-	styles, err := p.minifyCSS(p.Name(), util.Compact(styles))
+	emitted, files, inputs, err := p.minifyCSS(p.Name(), util.Compact(styles))
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+
+	// the critical CSS of the page is inlined all together
+	if p.CriticalCSS && len(emitted) > 0 {
+		var css []byte
+		for _, e := range emitted {
+			css = append(css, sourceMapComment.ReplaceAll(e.content, nil)...)
+		}
+		if tag, ok := inlineTag("style", "", css); ok {
+			return func() template.HTML { return template.HTML(tags + tag) }, files, inputs, nil
+		}
 	}
 
-	for _, name := range styles {
-		tags += p.StyleTag(name)
+	for _, e := range emitted {
+		if tag, ok := inlineTag("style", "", e.content); ok && p.inlinable(e.content) {
+			tags += tag
+		} else {
+			tags += p.StyleTag(e.name)
+		}
 	}
 
-	return func() template.HTML { return template.HTML(tags) }, nil
+	return func() template.HTML { return template.HTML(tags) }, files, inputs, nil
 }
 
-func (p *page) genImportScript(components []*Component) (func() template.HTML, error) {
+// runtimeTag inlines the runtime file when small enough, otherwise it gives the fallback tag
+func (p *page) runtimeTag(tag, attrs, fpath, fallback string) string {
+	if content, err := os.ReadFile(fpath); err == nil && p.inlinable(content) {
+		if inlined, ok := inlineTag(tag, attrs, content); ok {
+			return inlined
+		}
+	}
+	return fallback
+}
+
+func (p *page) genImportScript(components []Component) (func() template.HTML, []string, []string, error) {
 	var (
 		scripts, preScripts []string
 		modules, preModules []string
-		tags                = `<script type="text/javascript" src="` + p.ScriptURL("wed-utils") + `"></script>`
+		files, inputs       []string
+		classic             = noModule
+		tags                = p.runtimeTag("script", ` type="text/javascript"`, p.ScriptPath("wed-utils.js"),
+			p.ScriptTag("wed-utils", false, &classic))
 	)
 
 	if p.LiveServer != "" {
@@ -117,7 +208,7 @@ func (p *page) genImportScript(components []*Component) (func() template.HTML, e
 			modType = *c.Module
 		}
 
-		spath := p.ScriptPath(c.Name)
+		spath := p.ScriptSource(c.slug())
 		switch modType {
 		case "", noModule:
 			if scripts = append(scripts, spath); c.Preload {
@@ -143,11 +234,11 @@ func (p *page) genImportScript(components []*Component) (func() template.HTML, e
 			def = func(n string) bool { return !slices.Contains(preScripts, n) }
 		}
 
-		tag, err := p.minifyJS(p.Name(), noModule, util.Compact(scripts), def)
+		tag, out, in, err := p.minifyJS(p.Name(), noModule, util.Compact(scripts), def)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		tags += tag
+		tags, files, inputs = tags+tag, append(files, out...), append(inputs, in...)
 	}
 
 	if len(modules) > 0 {
@@ -161,24 +252,45 @@ func (p *page) genImportScript(components []*Component) (func() template.HTML, e
 			def = func(n string) bool { return !slices.Contains(preModules, n) }
 		}
 
-		tag, err := p.minifyJS(p.Name(), ecmaModule, util.Compact(modules), def)
+		tag, out, in, err := p.minifyJS(p.Name(), ecmaModule, util.Compact(modules), def)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
+		}
+		files, inputs = append(files, out...), append(inputs, in...)
+
+		if p.Legacy {
+			legacy, out, in, err := p.legacyJS(p.Name(), util.Compact(modules))
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			tag, files, inputs = tag+legacy, append(files, out...), append(inputs, in...)
+		}
+
+		var (
+			imports = p.importMap()
+			entries = make([]string, 0, len(imports))
+			urls    = make([]string, 0, len(imports))
+		)
+		for _, specifier := range slices.Sorted(maps.Keys(imports)) {
+			raw, _ := json.Marshal(specifier)
+			entries = append(entries, "\t"+string(raw)+`: "`+imports[specifier]+`"`)
+			urls = append(urls, imports[specifier])
 		}
 		tags += `<script type="importmap">{ "imports": {
-	"@wed/utils": "` + p.ScriptURL("wed-utils.mjs") + `",
-	"@wed/http": "` + p.ScriptURL("wed-http.mjs") + `"
-}}</script>` + tag
+` + strings.Join(entries, ",\n") + `
+}` + p.integrityMap(urls...) + `}</script>` + tag
 	}
 
-	return func() template.HTML { return template.HTML(tags) }, nil
+	return func() template.HTML { return template.HTML(tags) }, files, inputs, nil
 }
 
 func (p *page) importTemplate() (*template.Template, error) {
 	var (
-		scripts                   []*Component
-		styles, dynamics          []string
+		scripts, dynamics, heads  []Component
+		styles                    []string
 		importStyle, importScript func() template.HTML
+		styleFiles, scriptFiles   []string
+		styleInputs, scriptInputs []string
 	)
 
 	// Dependency check and collect imports
@@ -188,14 +300,17 @@ func (p *page) importTemplate() (*template.Template, error) {
 
 	for _, dep := range util.Inverse(p.deps) {
 		c := dep.Data
-		if c.Script != "" {
-			scripts = append(scripts, &c)
+		if c.Script != "" || c.Type == element {
+			scripts = append(scripts, c)
+		}
+		if c.Style != "" && c.Type != element {
+			styles = append(styles, p.StyleSource(c.slug()))
 		}
-		if c.Style != "" {
-			styles = append(styles, p.StylePath(c.Name))
+		if c.Type == dynamic || c.Type == hybrid {
+			dynamics = append(dynamics, c)
 		}
-		if c.Type != static {
-			dynamics = append(dynamics, c.Name)
+		if c.Head != "" {
+			heads = append(heads, c)
 		}
 	}
 
@@ -203,17 +318,17 @@ func (p *page) importTemplate() (*template.Template, error) {
 
 	go func() {
 		var err error
-		importStyle, err = p.genImportStyle(styles)
+		importStyle, styleFiles, styleInputs, err = p.genImportStyle(styles)
 		errch <- err
 	}()
 
 	go func() {
 		var err error
-		importScript, err = p.genImportScript(scripts)
+		importScript, scriptFiles, scriptInputs, err = p.genImportScript(scripts)
 		errch <- err
 	}()
 
-	importDynamic := p.genImportDynamic(dynamics)
+	importDynamic, importHead := p.genImportDynamic(dynamics), p.genImportHead(heads)
 	if err := <-errch; err != nil {
 		return nil, err
 	}
@@ -221,6 +336,10 @@ func (p *page) importTemplate() (*template.Template, error) {
 		return nil, err
 	}
 	close(errch)
+	p.assets = append(p.assets, append(styleFiles, scriptFiles...)...)
+	for _, fpath := range append(styleInputs, scriptInputs...) {
+		p.track(fpath)
+	}
 
 	templ := template.New(p.Name()).
 		Delims("{!{", "}!}").
@@ -233,15 +352,21 @@ func (p *page) importTemplate() (*template.Template, error) {
 					content = importStyle()
 				case "scripts":
 					content = importScript()
+				case "head":
+					content, err = importHead()
 				default:
 					err = fmt.Errorf("invalid import: %q not supported", val)
 				}
 				return
 			},
 			"page": func(val string) error {
-				p.Location = val
+				p.Location = filepath.Join(p.localePrefix(), val)
 				return nil
 			},
+			"sitemap": func(include bool) string {
+				p.unlisted = !include
+				return ""
+			},
 		})
 
 	return templ, nil
@@ -262,20 +387,17 @@ func (p *page) getVar(name string, def ...any) (any, error) {
 	return def, nil
 }
 
-func (p *page) Props(key string, def any) any {
-	return def
-}
-
 type ComponentInfo struct {
-	hybrid bool
-	holds  map[string]template.HTML
-	props  map[string]any
+	hybrid   bool
+	holds    map[string]template.HTML
+	props    map[string]any
+	declared []Prop
 }
 
 func (c ComponentInfo) Props(key string, def ...any) (val any, err error) {
 	switch len(def) {
 	case 0:
-		if c.hybrid {
+		if c.hybrid && !c.hasDefault(key) {
 			return nil, fmt.Errorf("cannot access hybrid component props without default value (key: %s)", key)
 		}
 		found := false
@@ -293,6 +415,15 @@ func (c ComponentInfo) Props(key string, def ...any) (val any, err error) {
 	return val, nil
 }
 
+func (c ComponentInfo) hasDefault(key string) bool {
+	for _, prop := range c.declared {
+		if prop.Name == key {
+			return prop.hasDef
+		}
+	}
+	return false
+}
+
 func (c *ComponentInfo) merge(another ComponentInfo) {
 	if len(another.holds) > 0 {
 		if c.holds == nil {
@@ -325,19 +456,36 @@ func (p *page) use(name string, opt ...ComponentInfo) (template.HTML, error) {
 		}
 	}
 
-	for _, c := range *p.components {
-		if c.Name == name {
-			dep, err := p.toDepencency(c)
-			if err != nil {
-				return "", err
-			}
-			p.deps = append(p.deps, dep)
-			data.hybrid = c.Type == hybrid
-			break
+	c, err := findComponent(*p.components, name)
+	if err != nil {
+		return "", fmt.Errorf("page %q: %w", p.Name(), err)
+	}
+
+	dep, err := p.toDepencency(c)
+	if err != nil {
+		return "", err
+	}
+	if data.props, err = c.checkProps(data.props); err != nil {
+		return "", fmt.Errorf("page %q using component %q: %w", p.Name(), name, err)
+	}
+	p.deps = append(p.deps, dep)
+	data.hybrid, data.declared = c.Type == hybrid, c.Props
+
+	// the head section is rendered once, with the props of the first use
+	if _, found := p.heads[c.Name]; c.Head != "" && !found {
+		if p.heads == nil {
+			p.heads = make(map[string]ComponentInfo)
 		}
+		p.heads[c.Name] = data
 	}
 
-	if err := p.ExecuteTemplate(&str, "wed-static-"+name, data); err != nil {
+	if c.Type == element {
+		if err := p.useElement(c, data); err != nil {
+			return "", err
+		}
+		return c.elementTag(data), nil
+	}
+	if err := p.ExecuteTemplate(&str, "wed-static-"+c.Name, data); err != nil {
 		return "", err
 	}
 	return template.HTML(str.String()), nil
@@ -349,17 +497,13 @@ func (p page) toDepencency(comp Component) (dep ComponentDependency, err error)
 	dep.Imports = make([]ComponentDependency, len(comp.Imports))
 
 	for i, name := range comp.Imports {
-		if p.Lookup("wed-static-"+name) == nil && p.Lookup("wed-dynamic-"+name) == nil {
-			err = fmt.Errorf("on component '%s' trying to require at place %d non existing component '%s'", comp.Name, i+1, name)
+		c, e := findComponent(*p.components, name)
+		if e != nil {
+			err = fmt.Errorf("on component '%s' trying to require at place %d: %w", comp.Name, i+1, e)
 			return
 		}
-		for _, c := range *p.components {
-			if c.Name == name {
-				if dep.Imports[i], err = p.toDepencency(c); err != nil {
-					return
-				}
-				break
-			}
+		if dep.Imports[i], err = p.toDepencency(c); err != nil {
+			return
 		}
 	}
 
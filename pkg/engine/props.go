@@ -0,0 +1,242 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrInvalidPropDecl = errors.New("invalid prop declaration")
+	ErrInvalidPropType = errors.New("invalid prop type")
+)
+
+type PropType string
+
+const (
+	anyProp    PropType = "any"
+	stringProp PropType = "string"
+	intProp    PropType = "int"
+	numberProp PropType = "number"
+	boolProp   PropType = "bool"
+	listProp   PropType = "list"
+	mapProp    PropType = "map"
+)
+
+func ParsePropType(raw string) (PropType, error) {
+	switch t := PropType(strings.ToLower(raw)); t {
+	case "":
+		return anyProp, nil
+	case anyProp, stringProp, intProp, numberProp, boolProp, listProp, mapProp:
+		return t, nil
+	case "float":
+		return numberProp, nil
+	}
+	return "", fmt.Errorf("%w '%s' allowed only 'any', 'string', 'int', 'number', 'bool', 'list' and 'map'", ErrInvalidPropType, raw)
+}
+
+// Accepts reports whether the given value can be used for a prop of this type
+func (t PropType) Accepts(val any) bool {
+	if t == anyProp || val == nil {
+		return true
+	}
+
+	switch v := reflect.ValueOf(val); v.Kind() {
+	case reflect.String:
+		return t == stringProp
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return t == intProp || t == numberProp
+	case reflect.Float32, reflect.Float64:
+		return t == numberProp
+	case reflect.Bool:
+		return t == boolProp
+	case reflect.Slice, reflect.Array:
+		return t == listProp
+	case reflect.Map:
+		return t == mapProp
+	}
+	return false
+}
+
+// zero is the value standing for a missing prop of this type
+func (t PropType) zero() any {
+	switch t {
+	case intProp, numberProp:
+		return 0
+	case boolProp:
+		return false
+	case listProp:
+		return []any{}
+	case mapProp:
+		return map[string]any{}
+	}
+	return ""
+}
+
+// Prop describes a single property declared on a component <props> block
+type Prop struct {
+	Name     string
+	Type     PropType
+	Default  any
+	Required bool
+	hasDef   bool
+}
+
+// ParseProps reads the content of a <props> block, one declaration each line:
+//
+//	<name> [type] [required | = <JSON default>]
+//
+// empty lines and lines starting with '//' are ignored
+func ParseProps(content string) (props []Prop, err error) {
+	for i, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		var prop Prop
+		decl, def, hasDef := strings.Cut(line, "=")
+		fields := strings.Fields(decl)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w at line %d: missing name", ErrInvalidPropDecl, i+1)
+		}
+
+		prop.Name = fields[0]
+		for _, p := range props {
+			if p.Name == prop.Name {
+				return nil, fmt.Errorf("%w at line %d: duplicate prop %q", ErrInvalidPropDecl, i+1, prop.Name)
+			}
+		}
+
+		switch fields = fields[1:]; len(fields) {
+		case 0:
+			prop.Type = anyProp
+		case 2:
+			if fields[1] != "required" {
+				return nil, fmt.Errorf("%w at line %d: unexpected %q", ErrInvalidPropDecl, i+1, fields[1])
+			}
+			prop.Required = true
+			fallthrough
+		case 1:
+			if fields[0] == "required" && !prop.Required {
+				prop.Type, prop.Required = anyProp, true
+			} else if prop.Type, err = ParsePropType(fields[0]); err != nil {
+				return nil, fmt.Errorf("at line %d: %w", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w at line %d: too many fields", ErrInvalidPropDecl, i+1)
+		}
+
+		if hasDef {
+			if prop.Required {
+				return nil, fmt.Errorf("%w at line %d: required prop %q cannot have a default value", ErrInvalidPropDecl, i+1, prop.Name)
+			}
+			if err = json.Unmarshal([]byte(strings.TrimSpace(def)), &prop.Default); err != nil {
+				return nil, fmt.Errorf("%w at line %d: default of %q is not valid JSON: %w", ErrInvalidPropDecl, i+1, prop.Name, err)
+			}
+			prop.Default = fromJSON(prop.Default)
+			if !prop.Type.Accepts(prop.Default) {
+				return nil, fmt.Errorf("%w at line %d: default of %q is not a valid %s", ErrInvalidPropDecl, i+1, prop.Name, prop.Type)
+			}
+			prop.hasDef = true
+		}
+
+		props = append(props, prop)
+	}
+	return
+}
+
+// fromJSON converts integral float64 values decoded from JSON into int
+// so that they behave like the integer constants of the template engine
+func fromJSON(val any) any {
+	switch v := val.(type) {
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	case []any:
+		for i := range v {
+			v[i] = fromJSON(v[i])
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = fromJSON(v[key])
+		}
+	}
+	return val
+}
+
+// checkProps validates the given values against the component declarations
+// and fills the missing ones with their defaults
+func (c Component) checkProps(props map[string]any) (map[string]any, error) {
+	if c.Props == nil {
+		return props, nil
+	}
+
+	var errs []error
+	props = maps.Clone(props)
+	for _, key := range slices.Sorted(maps.Keys(props)) {
+		if prop, found := c.prop(key); !found {
+			errs = append(errs, fmt.Errorf("unknown prop %q", key))
+		} else if val := props[key]; !prop.Type.Accepts(val) {
+			errs = append(errs, fmt.Errorf("prop %q expects %s, got %T", key, prop.Type, val))
+		}
+	}
+
+	for _, prop := range c.Props {
+		if _, found := props[prop.Name]; found {
+			continue
+		}
+		if prop.Required {
+			errs = append(errs, fmt.Errorf("missing required prop %q", prop.Name))
+		} else if prop.hasDef {
+			if props == nil {
+				props = make(map[string]any, len(c.Props))
+			}
+			props[prop.Name] = prop.Default
+		}
+	}
+
+	return props, errors.Join(errs...)
+}
+
+// checkDataProps ensures that all 'data-prop' attributes targets declared props
+func (c Component) checkDataProps() error {
+	if c.Props == nil {
+		return nil
+	}
+
+	for _, name := range dataProps(c.HTML) {
+		if _, found := c.prop(name); !found {
+			return fmt.Errorf("%w: 'data-prop' targets undeclared prop %q", ErrInvalidPropDecl, name)
+		}
+	}
+	return nil
+}
+
+func (c Component) prop(name string) (Prop, bool) {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Prop{}, false
+}
+
+// defaults returns the info used to render the component without any caller
+func (c Component) defaults() ComponentInfo {
+	info := ComponentInfo{hybrid: true, declared: c.Props}
+	for _, prop := range c.Props {
+		if prop.hasDef {
+			if info.props == nil {
+				info.props = make(map[string]any, len(c.Props))
+			}
+			info.props[prop.Name] = prop.Default
+		}
+	}
+	return info
+}
@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+const (
+	lockFile         = "wed-lock.json"
+	lockVersion      = 1
+	defaultRemoteDir = ".wed-remote"
+	remoteNamespace  = "wed-remote"
+)
+
+var ErrRemoteChanged = errors.New("remote module changed")
+
+// LockedModule is a remote module downloaded by the build
+type LockedModule struct {
+	// File is the downloaded copy, relative to the remote directory
+	File      string `json:"file"`
+	Integrity string `json:"integrity"`
+}
+
+// Lock pins each remote module imported by the scripts to the content first downloaded
+type Lock struct {
+	Version int                     `json:"version"`
+	Modules map[string]LockedModule `json:"modules"`
+
+	mu      sync.Mutex
+	dir     string
+	changed bool
+}
+
+// RemotePath gives the directory of the downloaded remote modules, relative to the project one
+func (s Settings) RemotePath() string {
+	if s.RemoteDir == "" {
+		return filepath.Join(s.ProjectDir, defaultRemoteDir)
+	}
+	if filepath.IsAbs(s.RemoteDir) {
+		return filepath.Clean(s.RemoteDir)
+	}
+	return filepath.Join(s.ProjectDir, s.RemoteDir)
+}
+
+// lockPath gives the path of the lock file, next to the settings one
+func (s Settings) lockPath() string {
+	return filepath.Join(s.ProjectDir, lockFile)
+}
+
+// LoadLock reads the lock file at fpath, the modules are downloaded in dir
+func LoadLock(fpath, dir string) (*Lock, error) {
+	var lock = &Lock{Version: lockVersion, Modules: make(map[string]LockedModule), dir: dir}
+
+	content, err := os.ReadFile(fpath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lock, nil
+	} else if err != nil {
+		return lock, err
+	}
+
+	if err = json.Unmarshal(content, lock); err != nil {
+		return lock, fmt.Errorf("malformed %s: %w", fpath, err)
+	}
+	if lock.Modules == nil {
+		lock.Modules = make(map[string]LockedModule)
+	}
+	return lock, nil
+}
+
+// Save writes the lock file at fpath, if new modules were downloaded
+func (l *Lock) Save(fpath string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.changed {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(fpath, content, 0644); err == nil {
+		l.changed = false
+	}
+	return err
+}
+
+// fetch gives the content of the remote module, downloading it only if not found on the
+// remote directory. Locked modules must match their integrity
+func (l *Lock) fetch(link string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	locked, found := l.Modules[link]
+	if found {
+		content, err := os.ReadFile(filepath.Join(l.dir, locked.File))
+		if err == nil && integrityOf(content) == locked.Integrity {
+			return content, nil
+		}
+	}
+
+	content, err := util.FetchContent(link)
+	if err != nil {
+		return nil, err
+	}
+
+	sri := integrityOf(content)
+	if found && sri != locked.Integrity {
+		return nil, fmt.Errorf("%w %q: locked as %s but downloaded %s, remove it from %s to accept the new content", ErrRemoteChanged, link, locked.Integrity, sri, lockFile)
+	}
+
+	sum := sha256.Sum256([]byte(link))
+	ext := path.Ext(strings.SplitN(link, "?", 2)[0])
+	if _, known := remoteLoaders[ext]; !known {
+		ext = ".js"
+	}
+	locked = LockedModule{File: hex.EncodeToString(sum[:8]) + ext, Integrity: sri}
+
+	if err = os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(filepath.Join(l.dir, locked.File), content, 0644); err != nil {
+		return nil, err
+	}
+
+	l.Modules[link], l.changed = locked, true
+	return content, nil
+}
+
+var remoteLoaders = map[string]esbuild.Loader{
+	".js":  esbuild.LoaderJS,
+	".mjs": esbuild.LoaderJS,
+	".cjs": esbuild.LoaderJS,
+	".jsx": esbuild.LoaderJSX,
+	".ts":  esbuild.LoaderTS,
+	".mts": esbuild.LoaderTS,
+	".tsx": esbuild.LoaderTSX,
+	".css": esbuild.LoaderCSS,
+}
+
+// remotePlugin makes esbuild bundle the modules imported by URL, together with their own
+// imports, using the copies pinned by the lock so the output works offline
+func (s Settings) remotePlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: remoteNamespace,
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^https?://`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				return esbuild.OnResolveResult{Path: args.Path, Namespace: remoteNamespace}, nil
+			})
+
+			// relative and absolute paths imported by remote modules belong to the same host
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^(\.{0,2}/)`, Namespace: remoteNamespace}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				base, err := url.Parse(args.Importer)
+				if err != nil {
+					return esbuild.OnResolveResult{}, err
+				}
+				ref, err := url.Parse(args.Path)
+				if err != nil {
+					return esbuild.OnResolveResult{}, err
+				}
+				return esbuild.OnResolveResult{Path: base.ResolveReference(ref).String(), Namespace: remoteNamespace}, nil
+			})
+
+			build.OnLoad(esbuild.OnLoadOptions{Filter: ".*", Namespace: remoteNamespace}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				if s.lock == nil {
+					return esbuild.OnLoadResult{}, fmt.Errorf("cannot import %q: remote modules are not enabled", args.Path)
+				}
+
+				content, err := s.lock.fetch(args.Path)
+				if err != nil {
+					return esbuild.OnLoadResult{}, err
+				}
+
+				var (
+					contents = string(content)
+					loader   = esbuild.LoaderJS
+				)
+				if l, found := remoteLoaders[path.Ext(strings.SplitN(args.Path, "?", 2)[0])]; found {
+					loader = l
+				}
+				return esbuild.OnLoadResult{Contents: &contents, Loader: loader}, nil
+			})
+		},
+	}
+}
@@ -3,8 +3,11 @@ package engine
 import (
 	"errors"
 	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
 )
 
 type ModuleType string
@@ -32,14 +35,93 @@ func (mt *ModuleType) UnmarshalJSON(raw []byte) error {
 	return err
 }
 
+type HTMLMode string
+
+const (
+	htmlAsIs   HTMLMode = ""
+	htmlMinify HTMLMode = "minify"
+	htmlPretty HTMLMode = "pretty"
+)
+
+func ParseHTMLMode(val string) (HTMLMode, error) {
+	switch val = strings.Trim(val, `"'`); HTMLMode(strings.ToLower(val)) {
+	case htmlAsIs:
+		return htmlAsIs, nil
+	case htmlMinify:
+		return htmlMinify, nil
+	case htmlPretty:
+		return htmlPretty, nil
+	}
+	return "", errors.New("Unsupported html mode '" + val + "', allowed only 'minify' or 'pretty'")
+}
+
+func (hm *HTMLMode) UnmarshalJSON(raw []byte) error {
+	val, err := ParseHTMLMode(string(raw))
+	if err == nil {
+		*hm = val
+	}
+	return err
+}
+
+// format applies the HTML output mode to the content of a page
+func (hm HTMLMode) format(content []byte) ([]byte, error) {
+	switch hm {
+	case htmlMinify:
+		return util.MinifyHTML(content)
+	case htmlPretty:
+		return util.PrettyHTML(content)
+	}
+	return content, nil
+}
+
 type Settings struct {
-	Var        map[string]any      `json:"vars,omitempty"`
-	Commands   map[string][]string `json:"commands,omitempty"`
-	OutputDir  string              `json:"output_dir,omitempty"`
-	InputDir   string              `json:"input_dir,omitempty"`
-	Module     ModuleType          `json:"module,omitempty"`
-	Minify     bool                `json:"minify,omitempty"`
-	LiveServer string              `json:"live_server,omitempty"`
+	Var            map[string]any       `json:"vars,omitempty"`
+	Commands       map[string][]string  `json:"commands,omitempty"`
+	OutputDir      string               `json:"output_dir,omitempty"`
+	InputDir       string               `json:"input_dir,omitempty"`
+	Module         ModuleType           `json:"module,omitempty"`
+	Minify         bool                 `json:"minify,omitempty"`
+	HTML           HTMLMode             `json:"html,omitempty"`
+	InlineLimit    int                  `json:"inline_limit,omitempty"`
+	CriticalCSS    bool                 `json:"critical_css,omitempty"`
+	Integrity      bool                 `json:"integrity,omitempty"`
+	CrossOrigin    string               `json:"crossorigin,omitempty"`
+	CSP            *CSP                 `json:"csp,omitempty"`
+	LiveServer     string               `json:"live_server,omitempty"`
+	BaseURL        string               `json:"base_url,omitempty"`
+	JSXFactory     string               `json:"jsx_factory,omitempty"`
+	JSXFragment    string               `json:"jsx_fragment,omitempty"`
+	Targets        string               `json:"targets,omitempty"`
+	Legacy         bool                 `json:"legacy,omitempty"`
+	Imports        map[string]string    `json:"imports,omitempty"`
+	RemoteDir      string               `json:"remote_dir,omitempty"`
+	QualifiedNames bool                 `json:"qualified_names,omitempty"`
+	ContentDir     string               `json:"content_dir,omitempty"`
+	MarkdownLayout string               `json:"markdown_layout,omitempty"`
+	Generate       map[string]Generator `json:"generate,omitempty"`
+	Locales        []string             `json:"locales,omitempty"`
+	DefaultLocale  string               `json:"default_locale,omitempty"`
+	Translations   string               `json:"translations,omitempty"`
+	CacheDir       string               `json:"cache_dir,omitempty"`
+	Fingerprint    bool                 `json:"fingerprint,omitempty"`
+	PublicDir      string               `json:"public_dir,omitempty"`
+	ImageWidths    []int                `json:"image_widths,omitempty"`
+	ImageSizes     string               `json:"image_sizes,omitempty"`
+	SiteURL        string               `json:"site_url,omitempty"`
+	Robots         []RobotsRule         `json:"robots,omitempty"`
+	Feeds          map[string]Feed      `json:"feeds,omitempty"`
+	// Fresh ignores the cache of the previous builds
+	Fresh bool `json:"-"`
+	// ProjectDir is the directory of the settings file, where the builds keep their state
+	ProjectDir string `json:"-"`
+	// fingerprints maps the URL of each emitted file to the one of its fingerprinted copy
+	fingerprints *util.Smap[string, string]
+	// integrities maps the URL of each emitted file to its subresource integrity
+	integrities *util.Smap[string, string]
+	// importURLs maps the specifiers of the imports setting to the URL of their published copy
+	importURLs map[string]string
+	// lock pins the remote modules imported by the scripts
+	lock *Lock
 }
 
 func (s Settings) StylePath(elem ...string) string {
@@ -66,6 +148,58 @@ func (s Settings) ScriptPath(elem ...string) string {
 	return filepath.Join(pices...)
 }
 
+// StyleSource gives the path of the component style read by esbuild, kept on the
+// state directory so that the output one is always written from the original
+func (s Settings) StyleSource(name string) string {
+	return filepath.Join(filepath.Dir(s.CachePath()), "style", name+".css")
+}
+
+// ScriptSource gives the path of the component script read by esbuild, kept on the
+// state directory so that the output one is always bundled from the original
+func (s Settings) ScriptSource(name string) string {
+	return filepath.Join(filepath.Dir(s.CachePath()), "script", name+".js")
+}
+
+// inputPath resolves the path given on the settings relative to the input directory
+func (s Settings) inputPath(fpath string) string {
+	if filepath.IsAbs(fpath) {
+		return fpath
+	}
+	return filepath.Join(s.InputDir, fpath)
+}
+
+// rootMarker prefixes the generated URLs, relative to the output directory, until the final
+// location of the page is known. Then it is replaced by the base URL or the path to the root
+const rootMarker = "__wed_root__"
+
+func rooted(link string) string {
+	return rootMarker + link
+}
+
+// rootPrefix gives the base URL or, if not set, the relative path from the page at location to the output directory
+func (s Settings) rootPrefix(location string) string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/") + "/"
+	}
+	return strings.Repeat("../", strings.Count(filepath.ToSlash(filepath.Clean(location)), "/"))
+}
+
+// BasePath gives the URL path the site is served at
+func (s Settings) BasePath() string {
+	if u, err := url.Parse(s.BaseURL); err == nil && u.Path != "" {
+		return strings.TrimSuffix(u.Path, "/") + "/"
+	}
+	return "/"
+}
+
+// LiveURL gives the URL of the live server endpoint, under the base path
+func (s Settings) LiveURL() string {
+	if u, err := url.Parse(s.LiveServer); err == nil && u.IsAbs() {
+		return s.LiveServer
+	}
+	return rooted(strings.TrimPrefix(path.Clean("/"+s.LiveServer), "/"))
+}
+
 func (s Settings) StyleURL(elem ...string) string {
 	if size := len(elem); size != 0 && filepath.Ext(elem[size-1]) == "" {
 		elem[size-1] += ".css"
@@ -74,7 +208,7 @@ func (s Settings) StyleURL(elem ...string) string {
 	if err != nil {
 		panic(err)
 	}
-	return link
+	return rooted(s.fingerprinted(link))
 }
 
 func (s Settings) ScriptURL(elem ...string) string {
@@ -85,11 +219,20 @@ func (s Settings) ScriptURL(elem ...string) string {
 	if err != nil {
 		panic(err)
 	}
-	return link
+	return rooted(s.fingerprinted(link))
 }
 
 func (s Settings) StyleTag(name string) string {
-	return `<link rel="stylesheet" href="` + s.StyleURL(name) + `" />`
+	href := s.StyleURL(name)
+	return `<link rel="stylesheet" href="` + href + `"` + s.integrityAttrs(href) + ` />`
+}
+
+// DeferredStyleTag loads the stylesheet without blocking the first paint
+func (s Settings) DeferredStyleTag(name string) string {
+	href := s.StyleURL(name)
+	attrs := s.integrityAttrs(href)
+	return `<link rel="preload" href="` + href + `" as="style"` + attrs + ` onload="this.onload=null;this.rel='stylesheet'" />` +
+		`<noscript><link rel="stylesheet" href="` + href + `"` + attrs + ` /></noscript>`
 }
 
 func (s Settings) ScriptTag(name string, deferred bool, overrideModule *ModuleType) string {
@@ -103,13 +246,20 @@ func (s Settings) ScriptTag(name string, deferred bool, overrideModule *ModuleTy
 		modType = *overrideModule
 	}
 
-	return `<script ` + d + `type="` + string(modType) + `" src="` + s.ScriptURL(name) + `"></script>`
+	src := s.ScriptURL(name)
+	return `<script ` + d + `type="` + string(modType) + `" src="` + src + `"` + s.integrityAttrs(src) + `></script>`
+}
+
+// LegacyScriptTag loads the bundle only on the browsers without ECMAScript modules
+func (s Settings) LegacyScriptTag(name string) string {
+	src := s.ScriptURL(name)
+	return `<script nomodule defer src="` + src + `"` + s.integrityAttrs(src) + `></script>`
 }
 
 func (s Settings) SSEClientTag() string {
 	return `<script>
 			(()=>{
-				const connection = new EventSource("` + s.LiveServer + `")
+				const connection = new EventSource("` + s.LiveURL() + `")
 
 				let i = 0
 				connection.onerror = err => {
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RobotsRule is a group of robots.txt directives for the crawlers matching UserAgent
+type RobotsRule struct {
+	UserAgent string   `json:"user_agent"`
+	Allow     []string `json:"allow,omitempty"`
+	Disallow  []string `json:"disallow,omitempty"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// meta gives the value of the first key found on the front matter or record of the page
+func (p *page) meta(keys ...string) (any, bool) {
+	var data map[string]any
+	switch d := p.data.(type) {
+	case PageData:
+		data = d.Meta
+	case map[string]any:
+		data = d
+	}
+
+	for _, key := range keys {
+		if val, found := data[key]; found {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// date gives the time of the first key found on the front matter or record of the page
+func (p *page) date(keys ...string) (time.Time, bool) {
+	val, found := p.meta(keys...)
+	if !found {
+		return time.Time{}, false
+	}
+
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// lastMod gives the date of the last page modification, taken from the "lastmod", "updated"
+// or "date" key of its front matter or record, otherwise from the source file
+func (p *page) lastMod() string {
+	if t, found := p.date("lastmod", "updated", "date"); found {
+		return t.Format(time.DateOnly)
+	}
+
+	if info, err := os.Stat(p.file); err == nil {
+		return info.ModTime().UTC().Format(time.DateOnly)
+	}
+	return ""
+}
+
+// listed reports if the page belongs to the sitemap, it can be excluded with the
+// {!{ sitemap false }!} directive or with the "sitemap: false" front matter
+func (p *page) listed() bool {
+	if p.unlisted {
+		return false
+	}
+	val, found := p.meta("sitemap")
+	return !found || fmt.Sprint(val) != "false"
+}
+
+// pageURL gives the absolute URL of the page at location, "index.html" is omitted
+func (s Settings) pageURL(location string) string {
+	location = filepath.ToSlash(location)
+	if path.Base(location) == "index.html" {
+		location = strings.TrimSuffix(location, "index.html")
+	}
+	return strings.TrimSuffix(s.SiteURL, "/") + "/" + location
+}
+
+// writeSitemap writes sitemap.xml listing the built pages, unless provided by the public directory
+func (td *TemplateData) writeSitemap() error {
+	if td.SiteURL == "" || isFile(filepath.Join(td.publicDir(), "sitemap.xml")) {
+		return nil
+	}
+
+	var set = sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, entry := range td.next.Pages {
+		if entry.Listed {
+			set.URLs = append(set.URLs, sitemapURL{Loc: td.pageURL(entry.Location), LastMod: entry.LastMod})
+		}
+	}
+	slices.SortFunc(set.URLs, func(a, b sitemapURL) int { return strings.Compare(a.Loc, b.Loc) })
+
+	return writeXML(filepath.Join(td.OutputDir, "sitemap.xml"), set)
+}
+
+// writeRobots writes robots.txt using the robots rules (by default allowing everything)
+// and linking the sitemap, unless provided by the public directory
+func (td *TemplateData) writeRobots() error {
+	if (td.SiteURL == "" && len(td.Robots) == 0) || isFile(filepath.Join(td.publicDir(), "robots.txt")) {
+		return nil
+	}
+
+	var (
+		robots strings.Builder
+		rules  = td.Robots
+	)
+	if len(rules) == 0 {
+		rules = []RobotsRule{{UserAgent: "*", Allow: []string{"/"}}}
+	}
+
+	for i, rule := range rules {
+		if i > 0 {
+			robots.WriteString("\n")
+		}
+		if rule.UserAgent == "" {
+			rule.UserAgent = "*"
+		}
+		robots.WriteString("User-agent: " + rule.UserAgent + "\n")
+		for _, val := range rule.Allow {
+			robots.WriteString("Allow: " + val + "\n")
+		}
+		for _, val := range rule.Disallow {
+			robots.WriteString("Disallow: " + val + "\n")
+		}
+	}
+
+	if td.SiteURL != "" {
+		robots.WriteString("\nSitemap: " + td.pageURL("sitemap.xml") + "\n")
+	}
+	return os.WriteFile(filepath.Join(td.OutputDir, "robots.txt"), []byte(robots.String()), 0644)
+}
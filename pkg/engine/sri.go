@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
+)
+
+const defaultCrossOrigin = "anonymous"
+
+// integrityOf gives the subresource integrity of the content
+func integrityOf(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// hashIntegrity records the integrity of the output file, also for its fingerprinted copy
+// (with the same content). Nothing is done if integrity is disabled
+func (s Settings) hashIntegrity(fpath string, content []byte) {
+	if !s.Integrity || s.integrities == nil {
+		return
+	}
+
+	var (
+		rel = s.outputRel(fpath)
+		sri = integrityOf(content)
+	)
+	s.integrities.Store(rel, sri)
+	if fp := s.fingerprinted(rel); fp != rel {
+		s.integrities.Store(fp, sri)
+	}
+}
+
+// integrityAttrs gives the integrity and crossorigin attributes of the tag linking the given URL
+func (s Settings) integrityAttrs(link string) string {
+	var attrs, crossOrigin = "", s.CrossOrigin
+	if s.Integrity && s.integrities != nil {
+		if sri, found := s.integrities.Load(strings.TrimPrefix(link, rootMarker)); found {
+			attrs = ` integrity="` + sri + `"`
+			if crossOrigin == "" {
+				crossOrigin = defaultCrossOrigin
+			}
+		}
+	}
+
+	if crossOrigin != "" {
+		attrs += ` crossorigin="` + crossOrigin + `"`
+	}
+	return attrs
+}
+
+// integrityMap gives the "integrity" section of the import map for the given URLs
+func (s Settings) integrityMap(links ...string) string {
+	if !s.Integrity || s.integrities == nil {
+		return ""
+	}
+
+	var entries []string
+	for _, link := range links {
+		if sri, found := s.integrities.Load(strings.TrimPrefix(link, rootMarker)); found {
+			entries = append(entries, "\t\""+link+`": "`+sri+`"`)
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return ",\n\"integrity\": {\n" + strings.Join(entries, ",\n") + "\n}"
+}
+
+// sri is the 'sri' template function giving the subresource integrity of an asset
+// (see findAsset) or of a remote resource, to be used on hand written tags
+func (p *page) sri(name string) (string, error) {
+	if util.IsRemote(name) {
+		p.volatile = true
+		content, err := util.FetchContent(name)
+		if err != nil {
+			return "", err
+		}
+		return integrityOf(content), nil
+	}
+
+	src, _, _, err := p.findAsset(name)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	p.track(src)
+	return integrityOf(content), nil
+}
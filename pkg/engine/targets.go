@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+var (
+	esVersions = map[string]esbuild.Target{
+		"esnext": esbuild.ESNext,
+		"es5":    esbuild.ES5,
+		"es6":    esbuild.ES2015,
+		"es2015": esbuild.ES2015,
+		"es2016": esbuild.ES2016,
+		"es2017": esbuild.ES2017,
+		"es2018": esbuild.ES2018,
+		"es2019": esbuild.ES2019,
+		"es2020": esbuild.ES2020,
+		"es2021": esbuild.ES2021,
+		"es2022": esbuild.ES2022,
+		"es2023": esbuild.ES2023,
+		"es2024": esbuild.ES2024,
+		"es2025": esbuild.ES2025,
+	}
+
+	engineNames = map[string]esbuild.EngineName{
+		"chrome":  esbuild.EngineChrome,
+		"edge":    esbuild.EngineEdge,
+		"firefox": esbuild.EngineFirefox,
+		"safari":  esbuild.EngineSafari,
+		"ios":     esbuild.EngineIOS,
+		"opera":   esbuild.EngineOpera,
+		"ie":      esbuild.EngineIE,
+	}
+)
+
+// legacyTarget is the syntax of the nomodule bundles, for the browsers without ECMAScript
+// modules (ex. IE11). esbuild fails on the features it cannot lower that far, like const
+const legacyTarget = esbuild.ES5
+
+// targets parses the comma separated browsers, like "chrome100, safari15", or ECMAScript
+// versions, like "es2017", of the targets setting, whose syntax esbuild lowers the output to.
+// Only the browsers affect the styles
+func (s Settings) targets() (target esbuild.Target, engines []esbuild.Engine, err error) {
+	for val := range strings.SplitSeq(s.Targets, ",") {
+		if val = strings.ToLower(strings.TrimSpace(val)); val == "" {
+			continue
+		}
+
+		if es, found := esVersions[val]; found {
+			target = es
+			continue
+		}
+
+		name := strings.TrimRight(val, "0123456789.")
+		engine, found := engineNames[name]
+		if !found || name == val {
+			return 0, nil, fmt.Errorf("unsupported target %q, allowed only ECMAScript versions (ex. es2017) or browsers with version (ex. chrome100) among: chrome, edge, firefox, safari, ios, opera and ie", val)
+		}
+		engines = append(engines, esbuild.Engine{Name: engine, Version: val[len(name):]})
+	}
+	return
+}
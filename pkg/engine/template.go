@@ -1,12 +1,17 @@
 package engine
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+
+	util "github.com/DazFather/Wednesday/pkg/shared"
 )
 
 type TemplateData struct {
@@ -14,28 +19,65 @@ type TemplateData struct {
 	Settings
 	pages      []*page
 	components []Component
+	layouts    map[string]*template.Template
+	catalogs   map[string]Catalog
+	// state of the incremental builds
+	prev, next    *Cache
+	reuse, parsed map[string]Component
+	layoutHashes  map[string]string
+	// files copied from the public directory
+	public []string
 }
 
-func NewTemplateData(s Settings) *TemplateData {
+// mockFuncs are the functions available to the page templates, used only for parsing
+func mockFuncs() template.FuncMap {
 	mock := func() error {
 		return fmt.Errorf("CALLING MOCKED CALL")
 	}
 
+	return template.FuncMap{
+		"list":     mock,
+		"embed":    mock,
+		"use":      mock,
+		"args":     mock,
+		"hold":     mock,
+		"drop":     mock,
+		"var":      mock,
+		"markdown": mock,
+		"extends":  mock,
+		"t":        mock,
+		"lang":     mock,
+		"hreflang": mock,
+		"asset":    mock,
+		"image":    mock,
+		"sri":      mock,
+	}
+}
+
+func NewTemplateData(s Settings) *TemplateData {
+	s.fingerprints = new(util.Smap[string, string])
+	s.integrities = new(util.Smap[string, string])
 	return &TemplateData{
-		Settings: s,
-		collected: template.New("temp").Funcs(template.FuncMap{
-			"list":  mock,
-			"embed": mock,
-			"use":   mock,
-			"args":  mock,
-			"hold":  mock,
-			"drop":  mock,
-			"var":   mock,
-		}),
+		Settings:     s,
+		collected:    template.New("temp").Funcs(mockFuncs()),
+		layouts:      make(map[string]*template.Template),
+		next:         NewCache(),
+		parsed:       make(map[string]Component),
+		layoutHashes: make(map[string]string),
 	}
 }
 
 func (td *TemplateData) AddComponent(c Component) (err error) {
+	for _, prev := range td.components {
+		if prev.Name == c.Name {
+			return fmt.Errorf("%w %q declared both in %q and %q", ErrDuplicateName, c.Name, prev.Path, c.Path)
+		}
+		// qualified names are flattened on files, classes and ids
+		if prev.slug() == c.slug() {
+			return fmt.Errorf("%w %q of %q and %q of %q both become %q", ErrDuplicateName, prev.Name, prev.Path, c.Name, c.Path, c.slug())
+		}
+	}
+
 	switch c.Type {
 	case static:
 		_, err = td.collected.New("wed-static-" + c.Name).Parse(c.WrappedStaticHTML())
@@ -46,8 +88,14 @@ func (td *TemplateData) AddComponent(c Component) (err error) {
 		fallthrough
 	case dynamic:
 		_, err = td.collected.New("wed-dynamic-" + c.Name).Parse(c.WrappedDynamicHTML())
+	case element:
+		_, err = td.collected.New("wed-element-" + c.Name).Parse(c.WrappedStaticHTML())
 	default:
-		return fmt.Errorf("invalid type %s", c.Type)
+		return fmt.Errorf("invalid type %d", c.Type)
+	}
+
+	if err == nil && c.Head != "" {
+		_, err = td.collected.New("wed-head-" + c.Name).Parse(c.Head)
 	}
 
 	if err == nil {
@@ -58,14 +106,23 @@ func (td *TemplateData) AddComponent(c Component) (err error) {
 }
 
 func (td *TemplateData) WriteComponent(c Component) (err error) {
-	if c.Style != "" {
-		if err = c.WriteStyle(td.StylePath(c.Name)); err != nil {
+	if c.Type == element {
+		script, err := td.renderElement(c)
+		if err != nil {
+			return fmt.Errorf("cannot render element %q: %w", c.Name, err)
+		}
+		c.Script = script
+	} else if c.Style != "" {
+		if err = c.WriteStyle(td.StyleSource(c.slug())); err != nil {
 			return err
 		}
 	}
 
 	if c.Script != "" {
-		return c.WriteScript(td.ScriptPath(c.Name))
+		if c.Script, err = td.transpile(c); err != nil {
+			return err
+		}
+		return c.WriteScript(td.ScriptSource(c.slug()))
 	}
 
 	return nil
@@ -80,11 +137,15 @@ func (td *TemplateData) buildStatics(errch chan<- error) bool {
 	wg.Add(len(td.components))
 	for _, c := range td.components {
 		go func(comp Component) {
-			if err := td.WriteComponent(comp); err != nil {
+			defer wg.Done()
+			if td.componentUpToDate(comp) {
+				td.next.setComponent(comp.Name, comp.hash)
+			} else if err := td.WriteComponent(comp); err != nil {
 				success = false
 				errch <- err
+			} else if comp.hash != "" {
+				td.next.setComponent(comp.Name, comp.hash)
 			}
-			wg.Done()
 		}(c)
 	}
 	wg.Wait()
@@ -92,50 +153,227 @@ func (td *TemplateData) buildStatics(errch chan<- error) bool {
 	return success
 }
 
+// builtPage is the output of a page waiting for all the others to be located
+type builtPage struct {
+	*page
+	hash    string
+	content []byte
+}
+
+// buildPages executes the pages and, once all of them have their final location, writes them
 func (td *TemplateData) buildPages(errch chan<- error) {
-	var wg sync.WaitGroup
+	var (
+		wg    sync.WaitGroup
+		built = make([]*builtPage, len(td.pages))
+	)
 
 	wg.Add(len(td.pages))
-	for _, page := range td.pages {
+	for i, page := range td.pages {
 		go func() {
 			defer wg.Done()
 
-			content, err := page.Build(td)
-			if err != nil {
-				errch <- err
+			hash := page.hash()
+			if entry, ok := td.pageUpToDate(page, hash); ok {
+				page.Location = entry.Location
+				td.next.setPage(page.Name(), entry)
 				return
 			}
 
-			if dir := filepath.Dir(page.Location); dir != "" {
-				if err = os.MkdirAll(filepath.Join(td.OutputDir, dir), 0755); err != nil {
-					errch <- err
-					return
-				}
-			}
-
-			if err = os.WriteFile(filepath.Join(td.OutputDir, page.Location), content, 0644); err != nil {
+			content, err := page.Build(page.data)
+			if err != nil {
 				errch <- err
 				return
 			}
+			if len(page.missing) > 0 {
+				errch <- Warning{fmt.Errorf("locale %q: page %q: %w: %s", page.locale, page.Name(), ErrMissingTranslation, strings.Join(page.missing, ", "))}
+			}
+			built[i] = &builtPage{page: page, hash: hash, content: content}
 		}()
 	}
+	wg.Wait()
 
+	if err := td.checkLocations(); err != nil {
+		errch <- err
+		return
+	}
+
+	for _, b := range built {
+		if b == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := td.writePage(b); err != nil {
+				errch <- fmt.Errorf("page %q: %w", b.Name(), err)
+			}
+		}()
+	}
 	wg.Wait()
 }
 
+// checkLocations makes sure no page overwrites another one
+func (td *TemplateData) checkLocations() error {
+	var (
+		errs      []error
+		locations = make(map[string]*page, len(td.pages))
+	)
+	for _, p := range td.pages {
+		loc := filepath.Clean(p.Location)
+		if prev, found := locations[loc]; found {
+			errs = append(errs, fmt.Errorf("pages %q (%s) and %q (%s) have the same location %q", prev.Name(), prev.file, p.Name(), p.file, loc))
+		} else {
+			locations[loc] = p
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkNames makes sure no page shares its name, keying its cache entry and its bundles, with another one
+func (td *TemplateData) checkNames() error {
+	var (
+		errs  []error
+		names = make(map[string]*page, len(td.pages))
+	)
+	for _, p := range td.pages {
+		if prev, found := names[p.Name()]; found {
+			errs = append(errs, fmt.Errorf("pages of %q (%s) and %q (%s) have the same name %q", prev.file, prev.Location, p.file, p.Location, p.Name()))
+		} else {
+			names[p.Name()] = p
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writePage formats the page content, applies its policy and writes it on the output directory
+func (td *TemplateData) writePage(b *builtPage) (err error) {
+	content := b.content
+	for _, sibling := range b.siblings {
+		content = bytes.ReplaceAll(content, []byte(sibling.marker()), []byte(filepath.ToSlash(sibling.Location)))
+	}
+	if content, err = td.HTML.format(content); err != nil {
+		return fmt.Errorf("cannot format html: %w", err)
+	}
+
+	var policy string
+	if td.CSP != nil {
+		var offset int
+		if policy, offset = td.CSP.policy(content); td.CSP.Mode == cspMeta {
+			content = withPolicy(content, policy, offset)
+		}
+	}
+
+	if dir := filepath.Dir(b.Location); dir != "" {
+		if err = os.MkdirAll(filepath.Join(td.OutputDir, dir), 0755); err != nil {
+			return err
+		}
+	}
+
+	if err = os.WriteFile(filepath.Join(td.OutputDir, b.Location), content, 0644); err != nil {
+		return err
+	}
+	// not cached to be reported again until translated
+	if len(b.missing) == 0 {
+		entry := b.entry(b.hash)
+		entry.CSP = policy
+		td.next.setPage(b.Name(), entry)
+	}
+	return nil
+}
+
+// Warning is a diagnostic of the build that does not make it fail
+type Warning struct{ Err error }
+
+func (w Warning) Error() string { return w.Err.Error() }
+
+func (w Warning) Unwrap() error { return w.Err }
+
+// IsWarning reports if err is only a diagnostic of the build
+func IsWarning(err error) bool {
+	var w Warning
+	return errors.As(err, &w)
+}
+
 func (td *TemplateData) Build() chan error {
 	var errch = make(chan error)
 
 	go func() {
 		defer close(errch)
+		if err := td.prepareRuntime(); err != nil {
+			errch <- fmt.Errorf("cannot prepare runtime files: %w", err)
+			return
+		}
+		if err := td.copyPublic(); err != nil {
+			errch <- err
+			return
+		}
+		if err := td.copyImports(); err != nil {
+			errch <- err
+			return
+		}
+
+		var err error
+		if td.lock, err = LoadLock(td.lockPath(), td.RemotePath()); err != nil {
+			errch <- err
+			return
+		}
 		if td.buildStatics(errch) {
 			td.buildPages(errch)
+			if err := td.lock.Save(td.lockPath()); err != nil {
+				errch <- fmt.Errorf("cannot write %s: %w", lockFile, err)
+			}
+			if err := td.writeManifest(); err != nil {
+				errch <- fmt.Errorf("cannot write manifest: %w", err)
+			}
+			if err := td.writeSitemap(); err != nil {
+				errch <- fmt.Errorf("cannot write sitemap: %w", err)
+			}
+			if err := td.writeRobots(); err != nil {
+				errch <- fmt.Errorf("cannot write robots.txt: %w", err)
+			}
+			if err := td.writeHeaders(); err != nil {
+				errch <- fmt.Errorf("cannot write %s: %w", headersFile, err)
+			}
+			if err := td.writeFeeds(); err != nil {
+				errch <- fmt.Errorf("cannot write feeds: %w", err)
+			}
 		}
 	}()
 
 	return errch
 }
 
+// componentName gives the name of the component declared at the given path,
+// prefixed by its directory relative to the input one if qualified names are used
+func (td *TemplateData) componentName(path, name string) string {
+	if !td.QualifiedNames {
+		return name
+	}
+
+	dir, err := filepath.Rel(td.InputDir, filepath.Dir(path))
+	if err != nil || dir == "." {
+		return name
+	}
+	return filepath.ToSlash(filepath.Join(dir, name))
+}
+
+// parseComponent creates the component declared at path, reusing the one of the
+// previous build if its content did not change
+func (td *TemplateData) parseComponent(path, name string, content []byte) (c Component, err error) {
+	name = td.componentName(path, name)
+	hash := hashOf(name, string(content))
+
+	c, found := td.reuse[path]
+	if !found || c.hash != hash {
+		if c, err = NewComponent(name, content); err != nil {
+			return
+		}
+		c.Path, c.hash = path, hash
+	}
+	td.parsed[path] = c
+	return
+}
+
 func (td *TemplateData) Walk() (errch chan error) {
 	if td.InputDir == "" {
 		td.InputDir = "."
@@ -143,24 +381,68 @@ func (td *TemplateData) Walk() (errch chan error) {
 
 	errch = make(chan error)
 	go func() {
+		defer close(errch)
+
+		var (
+			markdowns []string
+			generated = make(map[string]func() error, len(td.Generate))
+		)
+		if err := td.loadCatalogs(); err != nil {
+			errch <- err
+			return
+		}
 		err := filepath.WalkDir(td.InputDir, func(path string, info fs.DirEntry, err error) error {
 			if info.IsDir() {
+				// copied as they are
+				if (path == td.publicDir() || td.isImportSource(path)) && path != filepath.Clean(td.InputDir) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
 			switch name, ext := splitExt(info.Name()); ext {
 			case ".tmpl":
-				if content, err := os.ReadFile(path); err != nil {
+				content, err := os.ReadFile(path)
+				if err != nil {
 					errch <- fmt.Errorf("cannot read page template %q: %w", path, err)
-				} else if _, err := td.newPage(name).Parse(string(content)); err != nil {
+					break
+				}
+
+				if g, found := td.Generate[name]; found {
+					generated[name] = func() error { return td.addGeneratedPages(path, name, string(content), g) }
+					break
+				}
+
+				p := td.newPage(name)
+				p.source, p.file = string(content), path
+				if _, err = p.Parse(p.source); err != nil {
 					errch <- fmt.Errorf("cannot parse page template %q: %w", path, err)
 				}
-			case ".wed.html":
+			case ".layout.tmpl":
 				if content, err := os.ReadFile(path); err != nil {
+					errch <- fmt.Errorf("cannot read layout %q: %w", path, err)
+				} else if err = td.AddLayout(name, string(content)); err != nil {
+					errch <- fmt.Errorf("cannot parse layout %q: %w", path, err)
+				}
+			case ".md":
+				// wrapped after all layouts have been collected
+				if !td.isGeneratorSource(path) {
+					markdowns = append(markdowns, path)
+				}
+			case ".wed.html":
+				content, err := os.ReadFile(path)
+				if err != nil {
 					errch <- fmt.Errorf("cannot read component %q: %w", path, err)
-				} else if c, err := NewComponent(name, content); err != nil {
+					break
+				}
+
+				c, err := td.parseComponent(path, name, content)
+				if err != nil {
 					errch <- fmt.Errorf("cannot parse component %q: %w", path, err)
-				} else if err = td.AddComponent(c); err != nil {
+					break
+				}
+
+				if err = td.AddComponent(c); err != nil {
 					errch <- fmt.Errorf("cannot create component %q: %w", path, err)
 				}
 			}
@@ -170,33 +452,33 @@ func (td *TemplateData) Walk() (errch chan error) {
 		if err != nil {
 			errch <- err
 		}
-		close(errch)
-	}()
 
-	return
-}
-
-func Build(s Settings) chan error {
-	var (
-		td    = NewTemplateData(s)
-		errch = make(chan error)
-	)
-
-	go func() {
-		defer close(errch)
-		for _, fn := range []func() chan error{td.Walk, td.Build} {
-			failed := false
-			for err := range fn() {
+		for _, path := range markdowns {
+			if err = td.addMarkdownPage(path); err != nil {
 				errch <- err
-				if !failed {
-					failed = true
-				}
 			}
-			if failed {
-				return
+		}
+		for name := range td.Generate {
+			if generate, found := generated[name]; !found {
+				errch <- fmt.Errorf("cannot generate pages: missing page template %q", name)
+			} else if err = generate(); err != nil {
+				errch <- err
 			}
 		}
+		if err = td.localize(); err != nil {
+			errch <- err
+		}
+		// across templates, Markdown files, generated and localized pages
+		if err = td.checkNames(); err != nil {
+			errch <- err
+		}
 	}()
 
-	return errch
+	return
+}
+
+// Build walks the input directory and builds the site, skipping what did not
+// change since the build recorded on the cache
+func Build(s Settings) chan error {
+	return NewBuilder(s).Build()
 }
@@ -1,10 +1,13 @@
 package engine
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	esbuild "github.com/evanw/esbuild/pkg/api"
@@ -13,9 +16,15 @@ import (
 func splitExt(name string) (base, ext string) {
 	ext = strings.ToLower(filepath.Ext(name))
 	base = name[:len(name)-len(ext)]
-	if ext == ".html" {
+	switch ext {
+	case ".html":
 		ext = strings.ToLower(filepath.Ext(base)) + ext
 		base = name[:len(name)-len(ext)]
+	case ".tmpl":
+		if strings.ToLower(filepath.Ext(base)) == ".layout" {
+			ext = ".layout" + ext
+			base = name[:len(name)-len(ext)]
+		}
 	}
 	return
 }
@@ -26,8 +35,75 @@ func validHTML(content string) error {
 	return dec.Decode(new(interface{}))
 }
 
-func (s Settings) minifyJS(page string, mod ModuleType, entries []string, defers func(string) bool) (string, error) {
+// emitted is a style or script file written by esbuild
+type emitted struct {
+	name    string
+	content []byte
+}
+
+var sourceMapComment = regexp.MustCompile(`\s*(//# sourceMappingURL=[^\n]*|/\*# sourceMappingURL=[^*]*\*/)\s*$`)
+
+// inlinable reports if the content is small enough to be inlined on the page
+func (s Settings) inlinable(content []byte) bool {
+	return s.InlineLimit > 0 && len(content) <= s.InlineLimit
+}
+
+// inlineTag wraps the content of a style or script with the given tag, without the
+// source map link. It fails when the content would close the tag itself
+func inlineTag(tag, attrs string, content []byte) (string, bool) {
+	content = bytes.TrimSpace(sourceMapComment.ReplaceAll(content, nil))
+	if bytes.Contains(bytes.ToLower(content), []byte("</"+tag)) {
+		return "", false
+	}
+	return "<" + tag + attrs + ">" + string(content) + "</" + tag + ">", true
+}
+
+// transpile gives the component script as JavaScript, stripping the types and
+// transforming the JSX depending on its lang. Type-only imports are dropped
+func (s Settings) transpile(c Component) (string, error) {
+	var loader esbuild.Loader
+	switch c.Lang {
+	case "", langJS:
+		return c.Script, nil
+	case langTS:
+		loader = esbuild.LoaderTS
+	case langJSX:
+		loader = esbuild.LoaderJSX
+	case langTSX:
+		loader = esbuild.LoaderTSX
+	}
+
+	res := esbuild.Transform(c.Script, esbuild.TransformOptions{
+		Loader:      loader,
+		Sourcefile:  c.Path,
+		JSXFactory:  s.JSXFactory,
+		JSXFragment: s.JSXFragment,
+		LogLevel:    esbuild.LogLevelWarning,
+	})
+
+	if size := len(res.Errors); size > 0 {
+		errs := make([]error, size)
+		for i, msg := range res.Errors {
+			if msg.Location != nil {
+				errs[i] = fmt.Errorf("line %d: %s", msg.Location.Line, msg.Text)
+			} else {
+				errs[i] = errors.New(msg.Text)
+			}
+		}
+		return "", fmt.Errorf("%d esbuild errors during %s transpilation of component %s: %w", size, c.Lang, c.Name, errors.Join(errs...))
+	}
+	return string(res.Code), nil
+}
+
+func (s Settings) minifyJS(page string, mod ModuleType, entries []string, defers func(string) bool) (string, []string, []string, error) {
+	target, engines, err := s.targets()
+	if err != nil {
+		return "", nil, nil, err
+	}
+
 	var opt = esbuild.BuildOptions{
+		Target:            target,
+		Engines:           engines,
 		EntryPoints:       entries,
 		Bundle:            true,
 		Write:             true,
@@ -36,11 +112,10 @@ func (s Settings) minifyJS(page string, mod ModuleType, entries []string, defers
 		MinifySyntax:      true,
 		AllowOverwrite:    true,
 		Sourcemap:         esbuild.SourceMapLinked,
-		Alias: map[string]string{
-			"@wed/utils": "./" + filepath.ToSlash(s.ScriptPath("wed-utils.mjs")),
-			"@wed/http":  "./" + filepath.ToSlash(s.ScriptPath("wed-http.mjs")),
-		},
-		LogLevel: esbuild.LogLevelWarning,
+		Alias:             s.aliases(),
+		Plugins:           []esbuild.Plugin{s.remotePlugin()},
+		Metafile:          true,
+		LogLevel:          esbuild.LogLevelWarning,
 	}
 
 	switch mod {
@@ -58,6 +133,7 @@ func (s Settings) minifyJS(page string, mod ModuleType, entries []string, defers
 		} else {
 			opt.Bundle = false
 			opt.Alias = nil
+			opt.Plugins = nil
 			opt.Outdir = s.ScriptPath()
 		}
 	}
@@ -73,21 +149,51 @@ func (s Settings) minifyJS(page string, mod ModuleType, entries []string, defers
 		if s.Minify {
 			spec = "single file"
 		}
-		return "", fmt.Errorf("%d esbuild errors douring %s JS minification of page %s: %w", size, spec, page, errors.Join(errs...))
+		return "", nil, nil, fmt.Errorf("%d esbuild errors douring %s JS minification of page %s: %w", size, spec, page, errors.Join(errs...))
 	}
 
-	var output strings.Builder
+	var (
+		output strings.Builder
+		files  []string
+	)
 	for _, f := range res.OutputFiles {
-		if name := filepath.Base(f.Path); strings.ToLower(filepath.Ext(name)) != ".map" {
-			output.WriteString(s.ScriptTag(name, defers(name), &mod))
+		files = append(files, s.outputRel(f.Path))
+		name := filepath.Base(f.Path)
+		if strings.ToLower(filepath.Ext(name)) == ".map" {
+			continue
+		}
+
+		fp, err := s.fingerprint(f.Path, f.Contents)
+		if err != nil {
+			return "", nil, nil, err
+		} else if fp != "" {
+			files = append(files, s.outputRel(fp))
+		}
+		s.hashIntegrity(f.Path, f.Contents)
+
+		// inline classic scripts run immediately, so the deferred ones stay external
+		deferred := defers(name)
+		if s.inlinable(f.Contents) && (mod == ecmaModule || !deferred) {
+			if tag, ok := inlineTag("script", ` type="`+string(mod)+`"`, f.Contents); ok {
+				output.WriteString(tag)
+				continue
+			}
 		}
+		output.WriteString(s.ScriptTag(name, deferred, &mod))
 	}
 
-	return output.String(), nil
+	return output.String(), files, bundled(res.Metafile), nil
 }
 
-func (s Settings) minifyCSS(page string, entries []string) ([]string, error) {
+func (s Settings) minifyCSS(page string, entries []string) ([]emitted, []string, []string, error) {
+	target, engines, err := s.targets()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	var opt = esbuild.BuildOptions{
+		Target:            target,
+		Engines:           engines,
 		EntryPoints:       entries,
 		Bundle:            true,
 		Write:             true,
@@ -96,6 +202,7 @@ func (s Settings) minifyCSS(page string, entries []string) ([]string, error) {
 		MinifySyntax:      true,
 		AllowOverwrite:    true,
 		Sourcemap:         esbuild.SourceMapLinked,
+		Metafile:          true,
 		LogLevel:          esbuild.LogLevelWarning,
 	}
 
@@ -117,15 +224,130 @@ func (s Settings) minifyCSS(page string, entries []string) ([]string, error) {
 		if s.Minify {
 			spec = "single file"
 		}
-		return nil, fmt.Errorf("%d esbuild errors douring CSS %s minification of page %s: %w", size, spec, page, errors.Join(errs...))
+		return nil, nil, nil, fmt.Errorf("%d esbuild errors douring CSS %s minification of page %s: %w", size, spec, page, errors.Join(errs...))
 	}
 
-	var output []string
+	var (
+		output []emitted
+		files  []string
+	)
 	for _, f := range res.OutputFiles {
-		if name := filepath.Base(f.Path); strings.ToLower(filepath.Ext(name)) == ".css" {
-			output = append(output, name)
+		files = append(files, s.outputRel(f.Path))
+		name := filepath.Base(f.Path)
+		if strings.ToLower(filepath.Ext(name)) != ".css" {
+			continue
+		}
+
+		fp, err := s.fingerprint(f.Path, f.Contents)
+		if err != nil {
+			return nil, nil, nil, err
+		} else if fp != "" {
+			files = append(files, s.outputRel(fp))
 		}
+		s.hashIntegrity(f.Path, f.Contents)
+		output = append(output, emitted{name, f.Contents})
 	}
 
-	return output, nil
+	return output, files, bundled(res.Metafile), nil
+}
+
+// legacyJS bundles the ECMAScript module entries of the page into a single script
+// downleveled for the browsers without modules support, giving its tag
+func (s Settings) legacyJS(page string, entries []string) (string, []string, []string, error) {
+	var imports strings.Builder
+	for _, entry := range entries {
+		abs, err := filepath.Abs(entry)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		imports.WriteString(`import "` + filepath.ToSlash(abs) + "\";\n")
+	}
+
+	res := esbuild.Build(esbuild.BuildOptions{
+		Stdin: &esbuild.StdinOptions{
+			Contents:   imports.String(),
+			ResolveDir: ".",
+			Sourcefile: page + "-legacy.js",
+		},
+		Outfile:           s.ScriptPath(page + "-legacy"),
+		Bundle:            true,
+		Write:             true,
+		Format:            esbuild.FormatIIFE,
+		Target:            legacyTarget,
+		MinifyWhitespace:  true,
+		MinifyIdentifiers: true,
+		MinifySyntax:      true,
+		AllowOverwrite:    true,
+		Sourcemap:         esbuild.SourceMapLinked,
+		Alias:             s.aliases(),
+		Plugins:           []esbuild.Plugin{s.remotePlugin()},
+		Metafile:          true,
+		LogLevel:          esbuild.LogLevelWarning,
+	})
+
+	if size := len(res.Errors); size > 0 {
+		errs := make([]error, size)
+		for i, msg := range res.Errors {
+			if msg.Location != nil {
+				errs[i] = fmt.Errorf("%s:%d: %s", msg.Location.File, msg.Location.Line, msg.Text)
+			} else {
+				errs[i] = errors.New(msg.Text)
+			}
+		}
+		return "", nil, nil, fmt.Errorf("%d esbuild errors douring legacy JS bundling of page %s, whose syntax must be lowered to ES5: %w", size, page, errors.Join(errs...))
+	}
+
+	var (
+		output string
+		files  []string
+	)
+	for _, f := range res.OutputFiles {
+		rel := s.outputRel(f.Path)
+		if files = append(files, rel); strings.ToLower(filepath.Ext(rel)) == ".map" {
+			continue
+		}
+
+		fp, err := s.fingerprint(f.Path, f.Contents)
+		if err != nil {
+			return "", nil, nil, err
+		} else if fp != "" {
+			files = append(files, s.outputRel(fp))
+		}
+		s.hashIntegrity(f.Path, f.Contents)
+		output += s.LegacyScriptTag(strings.TrimPrefix(rel, "script/"))
+	}
+
+	return output, files, bundled(res.Metafile), nil
+}
+
+// bundled gives the files read by esbuild, listed on the metafile of the build,
+// so that the page is rebuilt when any of them changes
+func bundled(metafile string) []string {
+	var meta struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &meta); err != nil {
+		return nil
+	}
+
+	var inputs = make([]string, 0, len(meta.Inputs))
+	for input := range meta.Inputs {
+		// namespaced ones (ex. the remote modules) are not read from disk
+		if fpath := filepath.FromSlash(input); exists(fpath) {
+			inputs = append(inputs, fpath)
+		}
+	}
+	return inputs
+}
+
+// outputRel gives the slash separated path of the file relative to the output directory
+func (s Settings) outputRel(fpath string) string {
+	out, err := filepath.Abs(s.OutputDir)
+	if err == nil {
+		fpath, _ = filepath.Abs(fpath)
+		if rel, err := filepath.Rel(out, fpath); err == nil {
+			fpath = rel
+		}
+	}
+	return filepath.ToSlash(fpath)
 }
@@ -1,9 +1,13 @@
 package shared
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"regexp"
+	"slices"
 	"strings"
+	"unicode"
 
 	"golang.org/x/net/html"
 )
@@ -90,3 +94,297 @@ func ParsePlainHtml(r io.Reader, allowedTagNames []string, allowDuplicate bool)
 
 	return
 }
+
+// rawElements content is written as it is by MinifyHTML and PrettyHTML
+var rawElements = []string{"pre", "textarea", "script", "style"}
+
+var blockElements = []string{
+	"address", "article", "aside", "base", "blockquote", "body", "caption", "col", "colgroup", "dd",
+	"details", "dialog", "div", "dl", "dt", "fieldset", "figcaption", "figure", "footer", "form",
+	"h1", "h2", "h3", "h4", "h5", "h6", "head", "header", "hgroup", "hr", "html", "legend", "li",
+	"link", "main", "menu", "meta", "nav", "noscript", "ol", "optgroup", "option", "p", "pre",
+	"script", "section", "style", "summary", "table", "tbody", "td", "template", "tfoot", "th",
+	"thead", "title", "tr", "ul",
+}
+
+var voidElements = []string{
+	"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr",
+}
+
+// optionalEnds lists the end tags that can be omitted when followed by one of the
+// given start tags, by the end of the parent or by the end of the document
+var optionalEnds = map[string][]string{
+	"li":     {"li"},
+	"dt":     {"dt", "dd"},
+	"dd":     {"dt", "dd"},
+	"option": {"option", "optgroup"},
+	"tr":     {"tr"},
+	"td":     {"td", "th"},
+	"th":     {"td", "th"},
+	"thead":  {"tbody", "tfoot"},
+	"tbody":  {"tbody", "tfoot"},
+	"tfoot":  {},
+	"head":   {"body"},
+	"body":   {},
+	"html":   {},
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// compactTag collapses the whitespace of the raw tag outside of the attribute values
+func compactTag(raw string) string {
+	var (
+		res   strings.Builder
+		quote rune
+		space bool
+	)
+	for _, r := range raw {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+
+		if space && r != '>' && r != '/' {
+			res.WriteRune(' ')
+		}
+		space = false
+		res.WriteRune(r)
+	}
+	return res.String()
+}
+
+func isConditionalComment(raw string) bool {
+	return strings.HasPrefix(raw, "<!--[if") || strings.HasPrefix(raw, "<![endif]")
+}
+
+// MinifyHTML removes comments, collapses whitespace and drops the optional end tags
+// that are safe to omit. The content of <pre>, <textarea>, <script> and <style> is kept as it is
+func MinifyHTML(content []byte) ([]byte, error) {
+	var (
+		tokenizer = html.NewTokenizer(bytes.NewReader(content))
+		res       bytes.Buffer
+		raw       []string // stack of the raw elements opened
+		space     bool     // pending whitespace, written only between inline content
+		afterTag  = true   // the last written token was a block tag
+		pending   string   // optional end tag, dropped if followed by one of its siblings or by an end tag
+	)
+
+	// flush writes the pending optional end tag unless followed by one of its siblings
+	var flush = func(next string) {
+		if pending != "" && !slices.Contains(optionalEnds[pending], next) {
+			res.WriteString("</" + pending + ">")
+		}
+		pending = ""
+	}
+
+	for ttype := tokenizer.Next(); ttype != html.ErrorToken; ttype = tokenizer.Next() {
+		var rawToken = string(tokenizer.Raw())
+
+		if len(raw) > 0 {
+			name, _ := tokenizer.TagName()
+			switch tag := string(name); {
+			case ttype == html.EndTagToken && tag == raw[len(raw)-1]:
+				raw = raw[:len(raw)-1]
+			case ttype == html.StartTagToken && tag == raw[len(raw)-1]:
+				raw = append(raw, tag)
+			}
+			res.WriteString(rawToken)
+			continue
+		}
+
+		switch ttype {
+		case html.TextToken:
+			text := spaces.ReplaceAllString(rawToken, " ")
+			if strings.TrimSpace(text) == "" {
+				space = space || text != ""
+				continue
+			}
+
+			flush("")
+			if strings.HasPrefix(text, " ") {
+				space, text = true, text[1:]
+			}
+			if space && !afterTag {
+				res.WriteByte(' ')
+			}
+			space = strings.HasSuffix(text, " ")
+			res.WriteString(strings.TrimSuffix(text, " "))
+			afterTag = false
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			flush(tag)
+
+			block := slices.Contains(blockElements, tag)
+			if space && !block && !afterTag {
+				res.WriteByte(' ')
+			}
+			space = false
+			res.WriteString(compactTag(rawToken))
+			afterTag = block
+
+			if ttype == html.StartTagToken && slices.Contains(rawElements, tag) {
+				raw = append(raw, tag)
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			// the end of the parent closes it too
+			pending = ""
+
+			block := slices.Contains(blockElements, tag)
+			if space && !block {
+				res.WriteByte(' ')
+			}
+			space = false
+			if _, optional := optionalEnds[tag]; optional {
+				pending = tag
+			} else {
+				res.WriteString(compactTag(rawToken))
+			}
+			afterTag = block
+
+		case html.CommentToken:
+			if isConditionalComment(rawToken) {
+				flush("")
+				res.WriteString(rawToken)
+			}
+
+		case html.DoctypeToken:
+			res.WriteString("<!DOCTYPE html>")
+		}
+	}
+
+	if err := tokenizer.Err(); err != io.EOF {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// PrettyHTML reindents the content placing each block element on its own line, nested
+// using tabs, unless it holds only inline content. The content of <pre>, <textarea>,
+// <script> and <style> is kept as it is
+func PrettyHTML(content []byte) ([]byte, error) {
+	var (
+		tokenizer = html.NewTokenizer(bytes.NewReader(content))
+		res       bytes.Buffer
+		raw       []string
+		depth     int
+		newline   bool // next content starts on a new line
+		inline    bool // the current block holds only inline content so far
+		fresh     bool // nothing written since the start of the line or block
+		space     bool // pending whitespace, written only between inline content
+	)
+
+	var indent = func() {
+		if res.Len() > 0 {
+			res.WriteByte('\n')
+		}
+		res.WriteString(strings.Repeat("\t", depth))
+		newline, inline, fresh, space = false, false, true, false
+	}
+
+	var separate = func() {
+		switch {
+		case newline:
+			indent()
+		case space && !fresh:
+			res.WriteByte(' ')
+		}
+		space, fresh = false, false
+	}
+
+	for ttype := tokenizer.Next(); ttype != html.ErrorToken; ttype = tokenizer.Next() {
+		var (
+			rawToken = string(tokenizer.Raw())
+			name, _  = tokenizer.TagName()
+			tag      = string(name)
+			block    = slices.Contains(blockElements, tag)
+		)
+
+		if len(raw) > 0 {
+			switch {
+			case ttype == html.EndTagToken && tag == raw[len(raw)-1]:
+				raw = raw[:len(raw)-1]
+			case ttype == html.StartTagToken && tag == raw[len(raw)-1]:
+				raw = append(raw, tag)
+			}
+			res.WriteString(rawToken)
+			if len(raw) == 0 && block {
+				inline, newline = false, true
+			}
+			continue
+		}
+
+		switch ttype {
+		case html.TextToken:
+			text := spaces.ReplaceAllString(rawToken, " ")
+			if strings.TrimSpace(text) == "" {
+				space = space || text != ""
+				continue
+			}
+
+			space = space || strings.HasPrefix(text, " ")
+			separate()
+			space = strings.HasSuffix(text, " ")
+			res.WriteString(strings.TrimSpace(text))
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if block {
+				indent()
+			} else {
+				separate()
+			}
+			res.WriteString(compactTag(rawToken))
+
+			switch {
+			case ttype == html.SelfClosingTagToken || slices.Contains(voidElements, tag):
+				newline = newline || block
+			case slices.Contains(rawElements, tag):
+				raw = append(raw, tag)
+			case block:
+				depth++
+				inline, fresh = true, true
+			}
+
+		case html.EndTagToken:
+			if block {
+				depth = max(0, depth-1)
+				if !inline {
+					indent()
+				}
+				inline, newline, space = false, true, false
+			} else {
+				fresh = false
+				if space {
+					res.WriteByte(' ')
+					space = false
+				}
+			}
+			res.WriteString(compactTag(rawToken))
+
+		case html.CommentToken, html.DoctypeToken:
+			indent()
+			if ttype == html.DoctypeToken {
+				rawToken = "<!DOCTYPE html>"
+			}
+			res.WriteString(rawToken)
+			newline = true
+		}
+	}
+
+	if err := tokenizer.Err(); err != io.EOF {
+		return nil, err
+	}
+	res.WriteByte('\n')
+	return res.Bytes(), nil
+}
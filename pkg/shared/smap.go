@@ -8,6 +8,10 @@ type Smap[K comparable, V any] sync.Map
 
 func (s *Smap[K, V]) Load(key K) (V, bool) {
 	v, ok := (*sync.Map)(s).Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
 	return v.(V), ok
 }
 
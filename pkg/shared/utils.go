@@ -9,17 +9,20 @@ import (
 	"slices"
 )
 
+// Client performs the requests of FetchContent, it can be replaced by a local stand-in (ex. in tests)
+var Client = http.DefaultClient
+
 func getBody(link string) (content []byte, err error) {
-	res, err := http.Get(link)
+	res, err := Client.Get(link)
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
 
-	if 200 <= res.StatusCode && res.StatusCode < 300 {
-		return nil, errors.New("invalid status code '" + res.Status + "'")
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.New("invalid status code '" + res.Status + "' fetching " + link)
 	}
 
-	defer res.Body.Close()
 	return io.ReadAll(res.Body)
 }
 
@@ -31,9 +34,16 @@ func CleanURL(link string) (string, error) {
 	return u.RequestURI(), nil
 }
 
+// IsRemote reports if the link is an HTTP or HTTPS URL
+func IsRemote(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// FetchContent gives the body of the HTTP or HTTPS link, otherwise the content of the file at that path
 func FetchContent(link string) (content []byte, err error) {
-	if url, e := CleanURL(link); e == nil {
-		return getBody(url)
+	if IsRemote(link) {
+		return getBody(link)
 	}
 	return os.ReadFile(link)
 }